@@ -0,0 +1,349 @@
+// Package backup creates & restores archives of a Shoya installation. An archive is a gzipped tarball holding a logical
+// dump of every table, the {config} keys in Redis (including their history) and, optionally, the objects referenced by
+// file descriptors, along with a manifest recording the SHA-256 of each of them.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"gitlab.com/george/shoya-go/migrations"
+	"gitlab.com/george/shoya-go/services/files/files_client"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported backup format")
+	ErrChecksumMismatch  = errors.New("backup entry does not match its checksum")
+	ErrMissingEntry      = errors.New("backup entry is missing")
+	ErrDatabaseNotEmpty  = errors.New("database is not empty")
+)
+
+// FormatVersion is the version of the layout of the archives created by this build.
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	configName   = "config.jsonl"
+	tablesDir    = "tables"
+	objectsDir   = "objects"
+)
+
+// configKeyPattern matches the keys of the configuration in Redis, as well as those of its history.
+const configKeyPattern = "{config}:*"
+
+// Tables are the tables included in the dump, in the order they are restored in (referenced tables first).
+var Tables = []string{
+	"files",
+	"file_descriptors",
+	"file_versions",
+	"file_objects",
+	"avatars",
+	"worlds",
+	"avatar_unity_packages",
+	"world_unity_packages",
+	"users",
+	"favorite_groups",
+	"favorite_items",
+	"moderations",
+	"permissions",
+	"player_moderations",
+}
+
+type EntryKind string
+
+const (
+	EntryKindTable  EntryKind = "table"
+	EntryKindConfig EntryKind = "config"
+	EntryKindObject EntryKind = "object"
+)
+
+// Manifest describes the contents of an archive. It is its last entry.
+type Manifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	SchemaVersion int64     `json:"schemaVersion"` // SchemaVersion is the version of the newest migration applied to the dumped database.
+	Entries       []Entry   `json:"entries"`
+}
+
+// Entry is a file in an archive.
+type Entry struct {
+	Path        string    `json:"path"`                  // Path is the name of the file in the archive.
+	Kind        EntryKind `json:"kind"`                  // Kind is what the file holds.
+	Name        string    `json:"name"`                  // Name is the name of the table or object the file holds.
+	Count       int64     `json:"count,omitempty"`       // Count is the amount of rows (or config keys) in the file.
+	Size        int64     `json:"size"`                  // Size is the size of the file in bytes.
+	Sha256      string    `json:"sha256"`                // Sha256 is the hex-encoded SHA-256 of the file.
+	ContentType string    `json:"contentType,omitempty"` // ContentType is the content type of the object the file holds.
+}
+
+// configEntry is a key of the configuration in Redis, as dumped in config.jsonl.
+type configEntry struct {
+	Key    string   `json:"key"`
+	Type   string   `json:"type"` // Type is the Redis type of the key; either string (configuration values) or list (their history).
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// Create writes an archive of the database & configuration to w. The objects referenced by file descriptors are
+// included if a files client is passed. The schema of the database has to be up to date.
+func Create(ctx context.Context, w io.Writer, db *gorm.DB, rc *redis.Client, fc pb.FileClient) (*Manifest, error) {
+	if err := migrations.Check(db); err != nil {
+		return nil, err
+	}
+
+	statuses, err := migrations.Statuses(db)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{FormatVersion: FormatVersion, CreatedAt: time.Now().UTC(), SchemaVersion: statuses[len(statuses)-1].Version}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	// Every table is dumped from the same snapshot, so rows referencing each other are consistent. The objects are only
+	// listed in it, & downloaded once it is closed, so that it isn't held open (holding back vacuum) for their download.
+	var objects []referencedObject
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, t := range Tables {
+			e, err := addTable(tw, tx, t)
+			if err != nil {
+				return fmt.Errorf("table %s: %w", t, err)
+			}
+
+			log.Printf("Dumped table %s (%d rows)\n", t, e.Count)
+			m.Entries = append(m.Entries, *e)
+		}
+
+		if fc == nil {
+			return nil
+		}
+
+		var err error
+		objects, err = referencedObjects(tx)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	if fc != nil {
+		for _, o := range objects {
+			e, err := addObject(ctx, tw, fc, o.Name, o.ContentType)
+			if err != nil {
+				return nil, fmt.Errorf("object %s: %w", o.Name, err)
+			}
+
+			m.Entries = append(m.Entries, *e)
+		}
+
+		log.Printf("Archived %d objects\n", len(objects))
+	}
+
+	e, err := addConfig(ctx, tw, rc)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	log.Printf("Dumped %d config keys\n", e.Count)
+	m.Entries = append(m.Entries, *e)
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o640, Size: int64(len(b)), ModTime: m.CreatedAt}); err != nil {
+		return nil, err
+	}
+
+	if _, err = tw.Write(b); err != nil {
+		return nil, err
+	}
+
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return m, gz.Close()
+}
+
+// addTable dumps every row of the table (including soft-deleted ones) to the archive, as one JSON object per line.
+func addTable(tw *tar.Writer, tx *gorm.DB, table string) (*Entry, error) {
+	e := &Entry{Path: path.Join(tablesDir, table+".jsonl"), Kind: EntryKindTable, Name: table}
+
+	rows, err := tx.Table(table).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The size of an entry has to be known before it is written, so the dump is buffered in a temporary file.
+	return e, bufferEntry(tw, e, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for rows.Next() {
+			var row map[string]interface{}
+			if err := tx.ScanRows(rows, &row); err != nil {
+				return err
+			}
+
+			// Arrays (e.g.: tags) are scanned as their text representation, which is inserted as-is when restoring.
+			for k, v := range row {
+				if b, ok := v.([]byte); ok {
+					row[k] = string(b)
+				}
+			}
+
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+			e.Count++
+		}
+
+		return rows.Err()
+	})
+}
+
+// addConfig dumps the {config} keys to the archive, as one JSON object per line.
+func addConfig(ctx context.Context, tw *tar.Writer, rc *redis.Client) (*Entry, error) {
+	e := &Entry{Path: configName, Kind: EntryKindConfig, Name: "config"}
+
+	var keys []string
+	iter := rc.Scan(ctx, 0, configKeyPattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	return e, bufferEntry(tw, e, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, k := range keys {
+			c := configEntry{Key: k}
+
+			typ, err := rc.Type(ctx, k).Result()
+			if err != nil {
+				return err
+			}
+
+			switch typ {
+			case "string":
+				c.Type = typ
+				c.Value, err = rc.Get(ctx, k).Result()
+			case "list":
+				c.Type = typ
+				c.Values, err = rc.LRange(ctx, k, 0, -1).Result()
+			case "none":
+				continue // The key expired or was deleted since it was listed.
+			default:
+				return fmt.Errorf("key %s has unsupported type %s", k, typ)
+			}
+			if err != nil {
+				return err
+			}
+
+			if err = enc.Encode(c); err != nil {
+				return err
+			}
+			e.Count++
+		}
+
+		return nil
+	})
+}
+
+// referencedObject is an object in storage that holds the contents of a file descriptor.
+type referencedObject struct {
+	Name        string
+	ContentType string
+}
+
+// referencedObjects returns the objects holding the contents of complete file descriptors.
+func referencedObjects(tx *gorm.DB) ([]referencedObject, error) {
+	var objects []referencedObject
+	err := tx.Raw(`SELECT DISTINCT ON (name) COALESCE(NULLIF(fd.object_name, ''), fd.file_name) AS name, f.mime_type AS content_type
+		FROM file_descriptors fd JOIN files f ON f.id = fd.file_id
+		WHERE fd.status = 'complete' AND fd.deleted_at IS NULL AND f.deleted_at IS NULL
+		ORDER BY name`).Scan(&objects).Error
+
+	return objects, err
+}
+
+// addObject downloads the object through the files service straight into the archive.
+func addObject(ctx context.Context, tw *tar.Writer, fc pb.FileClient, name, contentType string) (*Entry, error) {
+	e := &Entry{Path: path.Join(objectsDir, name), Kind: EntryKindObject, Name: name, ContentType: contentType}
+
+	st, err := fc.StatFile(ctx, &pb.StatFileRequest{Name: &name})
+	if err != nil {
+		return nil, err
+	}
+
+	if !st.GetExists() {
+		return nil, errors.New("object not found in storage")
+	}
+
+	e.Size = st.GetSize()
+	if err = tw.WriteHeader(&tar.Header{Name: e.Path, Mode: 0o640, Size: e.Size, ModTime: time.Now().UTC()}); err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	n, err := files_client.Download(ctx, fc, name, io.MultiWriter(tw, h))
+	if err != nil {
+		return nil, err
+	}
+
+	if n != e.Size {
+		return nil, fmt.Errorf("size changed while downloading (expected %d bytes, got %d bytes)", e.Size, n)
+	}
+
+	e.Sha256 = hex.EncodeToString(h.Sum(nil))
+	return e, nil
+}
+
+// bufferEntry writes the output of fn to a temporary file, and then adds it to the archive as the entry.
+func bufferEntry(tw *tar.Writer, e *Entry, fn func(w io.Writer) error) error {
+	f, err := os.CreateTemp("", "shoya-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	if err = fn(io.MultiWriter(f, h)); err != nil {
+		return err
+	}
+
+	if e.Size, err = f.Seek(0, io.SeekCurrent); err != nil {
+		return err
+	}
+	e.Sha256 = hex.EncodeToString(h.Sum(nil))
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err = tw.WriteHeader(&tar.Header{Name: e.Path, Mode: 0o640, Size: e.Size, ModTime: time.Now().UTC()}); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
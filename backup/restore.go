@@ -0,0 +1,344 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"gitlab.com/george/shoya-go/migrations"
+	"gitlab.com/george/shoya-go/services/files/files_client"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// restoreBatchSize is the amount of rows inserted at once when restoring a table.
+const restoreBatchSize = 500
+
+// Verify reads the archive at the path, and checks that every entry listed in its manifest is present & matches its
+// checksum. The manifest is returned.
+func Verify(name string) (*Manifest, error) {
+	var m *Manifest
+	var sums = map[string]string{}
+
+	err := walk(name, func(h *tar.Header, r io.Reader) error {
+		if h.Name == manifestName {
+			return json.NewDecoder(r).Decode(&m)
+		}
+
+		s := sha256.New()
+		if _, err := io.Copy(s, r); err != nil {
+			return err
+		}
+
+		sums[h.Name] = hex.EncodeToString(s.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMissingEntry, manifestName)
+	}
+
+	if m.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("%w: %d (expected %d)", ErrUnsupportedFormat, m.FormatVersion, FormatVersion)
+	}
+
+	for _, e := range m.Entries {
+		sum, ok := sums[e.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingEntry, e.Path)
+		}
+
+		if sum != e.Sha256 {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, e.Path)
+		}
+	}
+
+	return m, nil
+}
+
+// Restore rebuilds an installation from the archive at the path. The archive is verified first, and the database has to
+// be empty; it is migrated to the schema version of the archive before the rows are inserted, in a single transaction.
+// The {config} keys in Redis are replaced by those in the archive. Objects are uploaded through the files service if a
+// files client is passed, and skipped otherwise; if the database can't be restored, the uploaded objects are deleted again.
+func Restore(ctx context.Context, name string, db *gorm.DB, rc *redis.Client, fc pb.FileClient) (*Manifest, error) {
+	m, err := Verify(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = prepareDatabase(db, m.SchemaVersion); err != nil {
+		return nil, err
+	}
+
+	entries := map[string]Entry{}
+	for _, e := range m.Entries {
+		entries[e.Path] = e
+	}
+
+	var config []configEntry
+	var uploaded []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Entries are restored in the order they were archived in, which is the order of Tables.
+		return walk(name, func(h *tar.Header, r io.Reader) error {
+			e, ok := entries[h.Name]
+			if !ok {
+				return nil
+			}
+
+			switch e.Kind {
+			case EntryKindTable:
+				if err := restoreTable(tx, e.Name, r); err != nil {
+					return fmt.Errorf("table %s: %w", e.Name, err)
+				}
+
+				log.Printf("Restored table %s (%d rows)\n", e.Name, e.Count)
+			case EntryKindConfig:
+				// The config is applied once the database is restored.
+				dec := json.NewDecoder(r)
+				for {
+					var c configEntry
+					if err := dec.Decode(&c); errors.Is(err, io.EOF) {
+						break
+					} else if err != nil {
+						return fmt.Errorf("config: %w", err)
+					}
+
+					config = append(config, c)
+				}
+			case EntryKindObject:
+				if fc == nil {
+					return nil
+				}
+
+				if err := restoreObject(ctx, fc, e, r); err != nil {
+					return fmt.Errorf("object %s: %w", e.Name, err)
+				}
+				uploaded = append(uploaded, e.Name)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		// The rows referencing the uploaded objects were rolled back, so nothing would ever delete them.
+		deleteObjects(fc, uploaded)
+		return nil, err
+	}
+
+	if fc != nil {
+		log.Printf("Restored %d objects\n", len(uploaded))
+	}
+
+	if err = restoreConfig(ctx, rc, config); err != nil {
+		return nil, fmt.Errorf("the database was restored, but the config could not be: %w", err)
+	}
+
+	log.Printf("Restored %d config keys\n", len(config))
+	return m, nil
+}
+
+// prepareDatabase checks that the database is empty & not ahead of the archive, and migrates it to the version.
+func prepareDatabase(db *gorm.DB, version int64) error {
+	statuses, err := migrations.Statuses(db)
+	if err != nil {
+		return err
+	}
+
+	known := false
+	for _, s := range statuses {
+		if s.Version == version && !s.Unknown {
+			known = true
+		}
+
+		if s.Applied && s.Version > version {
+			return fmt.Errorf("the database schema (migration %d) is newer than the one of the backup (migration %d); restore into a fresh database", s.Version, version)
+		}
+	}
+
+	if !known {
+		return fmt.Errorf("the backup was created with a newer schema (migration %d); restore it with a newer build", version)
+	}
+
+	for _, t := range Tables {
+		if !db.Migrator().HasTable(t) {
+			continue
+		}
+
+		var exists bool
+		if err = db.Raw(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %q)", t)).Scan(&exists).Error; err != nil {
+			return err
+		}
+
+		if exists {
+			return fmt.Errorf("%w: table %s has rows", ErrDatabaseNotEmpty, t)
+		}
+	}
+
+	applied, err := migrations.Up(db, version)
+	for _, a := range applied {
+		log.Printf("Applied migration %d (%s)\n", a.Version, a.Name)
+	}
+
+	return err
+}
+
+// restoreTable inserts the rows dumped by addTable.
+func restoreTable(tx *gorm.DB, table string, r io.Reader) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber() // Numbers are inserted as they were dumped, without a round-trip through float64.
+
+	var batch []map[string]interface{}
+	for {
+		var row map[string]interface{}
+		err := dec.Decode(&row)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if row != nil {
+			batch = append(batch, row)
+		}
+
+		if len(batch) != 0 && (len(batch) == restoreBatchSize || err != nil) {
+			if err := tx.Table(table).Create(&batch).Error; err != nil {
+				return err
+			}
+			batch = nil
+		}
+
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// restoreObject uploads an object archived by addObject through the files service, under the same name.
+func restoreObject(ctx context.Context, fc pb.FileClient, e Entry, r io.Reader) error {
+	// Uploads need to seek in the contents (e.g.: to upload them in parts), so they are buffered in a temporary file.
+	f, err := os.CreateTemp("", "shoya-restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := md5.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return err
+	}
+
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	_, err = files_client.Upload(ctx, fc, e.Name, f, size, base64.StdEncoding.EncodeToString(h.Sum(nil)), contentType)
+	return err
+}
+
+// deleteObjects deletes the objects through the files service, logging the ones that could not be deleted.
+func deleteObjects(fc pb.FileClient, names []string) {
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := fc.DeleteFile(ctx, &pb.DeleteFileRequest{Name: &name}); err != nil {
+			log.Printf("failed to delete object %s: %v", name, err)
+		}
+		cancel()
+	}
+}
+
+// restoreConfig replaces the {config} keys in Redis with the dumped ones. The keys share the {config} hash tag, so they
+// are replaced in a single transaction.
+func restoreConfig(ctx context.Context, rc *redis.Client, config []configEntry) error {
+	var existing []string
+	iter := rc.Scan(ctx, 0, configKeyPattern, 100).Iterator()
+	for iter.Next(ctx) {
+		existing = append(existing, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	_, err := rc.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(existing) != 0 {
+			pipe.Del(ctx, existing...)
+		}
+
+		for _, c := range config {
+			switch c.Type {
+			case "string":
+				pipe.Set(ctx, c.Key, c.Value, 0)
+			case "list":
+				if len(c.Values) != 0 {
+					pipe.RPush(ctx, c.Key, toInterfaces(c.Values)...)
+				}
+			default:
+				return fmt.Errorf("key %s has unsupported type %s", c.Key, c.Type)
+			}
+		}
+
+		return nil
+	})
+	return err
+}
+
+// walk calls fn with every regular file in the archive at the path, in order.
+func walk(name string, fn func(h *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err = fn(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func toInterfaces(s []string) []interface{} {
+	var values = make([]interface{}, len(s))
+	for i := range s {
+		values[i] = s[i]
+	}
+
+	return values
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gitlab.com/george/shoya-go/backup"
+	"gitlab.com/george/shoya-go/config"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"gitlab.com/george/shoya-go/services/api"
+	"log"
+	"os"
+	"time"
+)
+
+func init() {
+	backupCreateCmd.Flags().StringP("output", "o", "", "the path the archive is written to (defaults to shoya-backup-<timestamp>.tar.gz)")
+	backupCreateCmd.Flags().Bool("objects", false, "include the objects referenced by file descriptors (downloaded through the files service)")
+	backupRestoreCmd.Flags().Bool("skip-objects", false, "do not upload the objects in the archive to the files service")
+
+	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+	backupCmd.AddCommand(backupVerifyCmd)
+
+	rootCmd.AddCommand(backupCmd)
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "create & restore backups of a shoya installation",
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "archives the database, the configuration &, optionally, the stored objects",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		objects, _ := cmd.Flags().GetBool("objects")
+		if output == "" {
+			output = fmt.Sprintf("shoya-backup-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+		}
+
+		initializeRedis()
+		initializeApiConfig()
+		initializeDB()
+
+		var fc pb.FileClient
+		if objects {
+			fc = dialFilesService()
+		}
+
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			log.Fatalf("failed to create archive: %v", err)
+		}
+
+		m, err := backup.Create(context.Background(), f, config.DB, config.HarvestRedisClient, fc)
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(output)
+			log.Fatalf("failed to create backup: %v", err)
+		}
+
+		log.Printf("Backup %s has been created (%d entries, schema version %d)\n", output, len(m.Entries), m.SchemaVersion)
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <archive>",
+	Short: "restores a backup into a fresh installation (the database has to be empty)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		skipObjects, _ := cmd.Flags().GetBool("skip-objects")
+
+		m, err := backup.Verify(args[0])
+		if err != nil {
+			log.Fatalf("failed to verify backup: %v", err)
+		}
+
+		initializeRedis()
+		initializeApiConfig()
+		initializeDB()
+
+		var fc pb.FileClient
+		if countEntries(m, backup.EntryKindObject) != 0 {
+			if skipObjects {
+				log.Println("Warning: the objects in the archive are skipped; files referencing them will be unavailable")
+			} else {
+				fc = dialFilesService()
+			}
+		}
+
+		if _, err = backup.Restore(context.Background(), args[0], config.DB, config.HarvestRedisClient, fc); err != nil {
+			log.Fatalf("failed to restore backup: %v", err)
+		}
+
+		log.Printf("Backup %s (created at %s) has been restored\n", args[0], m.CreatedAt.Format(time.RFC3339))
+	},
+}
+
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify <archive>",
+	Short: "checks the integrity of a backup & lists its contents",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := backup.Verify(args[0])
+		if err != nil {
+			log.Fatalf("failed to verify backup: %v", err)
+		}
+
+		tb := table.NewWriter()
+		tb.SetOutputMirror(os.Stdout)
+		tb.AppendHeader(table.Row{"Kind", "Name", "Count", "Size", "SHA-256"})
+		for _, e := range m.Entries {
+			tb.AppendRow(table.Row{e.Kind, e.Name, e.Count, e.Size, e.Sha256})
+		}
+		tb.Render()
+
+		log.Printf("Backup %s is intact (created at %s, schema version %d)\n", args[0], m.CreatedAt.Format(time.RFC3339), m.SchemaVersion)
+	},
+}
+
+func dialFilesService() pb.FileClient {
+	fc, err := api.DialFilesService(config.ApiConfiguration.FilesEndpoint.Get(), config.RuntimeConfig.Api.Files)
+	if err != nil {
+		log.Fatalf("failed to connect to the files service: %v", err)
+	}
+
+	return fc
+}
+
+func countEntries(m *backup.Manifest, kind backup.EntryKind) int {
+	var n int
+	for _, e := range m.Entries {
+		if e.Kind == kind {
+			n++
+		}
+	}
+
+	return n
+}
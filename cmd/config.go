@@ -2,18 +2,33 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"gitlab.com/george/shoya-go/config"
 	"log"
 	"os"
-	"reflect"
+	"strconv"
+	"time"
 )
 
+// configLsMaxValueLength is the length after which values are truncated by `config ls` & `config history`.
+const configLsMaxValueLength = 64
+
 func init() {
+	configSetCmd.Flags().String("file", "", "read the value from a file (e.g.: for JSON values)")
+	configExportCmd.Flags().StringP("output", "o", "", "write the snapshot to a file instead of stdout")
+	configImportCmd.Flags().Bool("dry-run", false, "only show what would change")
+
 	configCmd.AddCommand(configLsCmd)
 	configCmd.AddCommand(configGetCmd)
 	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configDiffCmd)
+	configCmd.AddCommand(configExportCmd)
+	configCmd.AddCommand(configImportCmd)
+	configCmd.AddCommand(configHistoryCmd)
+	configCmd.AddCommand(configRollbackCmd)
 
 	rootCmd.AddCommand(configCmd)
 }
@@ -25,8 +40,9 @@ var configCmd = &cobra.Command{
 
 var configLsCmd = &cobra.Command{
 	Use:   "ls",
-	Short: "lists all configuration values",
+	Short: "lists all configuration values along with their types",
 	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
 		configLs()
 	},
 }
@@ -37,84 +53,259 @@ var configGetCmd = &cobra.Command{
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initializeRedis()
-		initializeApiConfig()
 		configGet(args)
 	},
 }
 
 var configSetCmd = &cobra.Command{
-	Use:   "set",
-	Short: "sets a configuration value in Redis",
-	Args:  cobra.ExactArgs(2),
+	Use:   "set <key> [value]",
+	Short: "validates & sets a configuration value in Redis",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		if (file == "") == (len(args) == 1) {
+			log.Fatalf("either a value or --file has to be passed")
+		}
+
+		value := ""
+		if file != "" {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("failed to read %s: %v", file, err)
+			}
+			value = string(b)
+		} else {
+			value = args[1]
+		}
+
+		initializeRedis()
+		configSet(args[0], value)
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "reverts a configuration value to its default (seed) value",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initializeRedis()
-		initializeApiConfig()
-		configSet(args)
+		f := lookupConfigField(args[0])
+		configSet(f.Name, f.Seed)
+	},
+}
+
+var configDiffCmd = &cobra.Command{
+	Use:   "diff [snapshot]",
+	Short: "shows the values that differ from their defaults, or from a snapshot created by `config export`",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		current := getConfigValues()
+		if len(args) == 0 {
+			renderConfigChanges(config.DiffApiConfigValues(config.ApiConfigSeeds(), current), "Default", "Current")
+			return
+		}
+
+		renderConfigChanges(config.DiffApiConfigValues(current, readConfigSnapshot(args[0])), "Current", "Snapshot")
+	},
+}
+
+var configExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "writes a snapshot of all configuration values (including secrets) as JSON",
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		b, err := json.MarshalIndent(getConfigValues(), "", "  ")
+		if err != nil {
+			log.Fatalf("failed to export config: %v", err)
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			os.Stdout.Write(append(b, '\n'))
+			return
+		}
+
+		if err = os.WriteFile(output, append(b, '\n'), 0o600); err != nil {
+			log.Fatalf("failed to write %s: %v", output, err)
+		}
+		log.Printf("Config has been exported to %s\n", output)
+	},
+}
+
+var configImportCmd = &cobra.Command{
+	Use:   "import <snapshot>",
+	Short: "restores the configuration values of a snapshot created by `config export`",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		snapshot := readConfigSnapshot(args[0])
+		changes := config.DiffApiConfigValues(getConfigValues(), snapshot)
+		renderConfigChanges(changes, "Current", "Snapshot")
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return
+		}
+
+		if err := config.SetApiConfigValues(context.Background(), snapshot, operator()); err != nil {
+			log.Fatalf("failed to import config: %v", err)
+		}
+		log.Printf("Config has been imported (%d values changed)\n", len(changes))
+	},
+}
+
+var configHistoryCmd = &cobra.Command{
+	Use:   "history <key>",
+	Short: "shows the recorded changes of a configuration value, oldest first",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		configHistory(lookupConfigField(args[0]))
+	},
+}
+
+var configRollbackCmd = &cobra.Command{
+	Use:   "rollback <key> [version]",
+	Short: "restores a configuration value as of a version, or undoes its latest change if no version is given",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var version int64
+		if len(args) == 2 {
+			var err error
+			if version, err = strconv.ParseInt(args[1], 10, 64); err != nil || version < 1 {
+				log.Fatalf("invalid version: %s", args[1])
+			}
+		}
+
+		initializeRedis()
+		f := lookupConfigField(args[0])
+		e, err := config.RollbackApiConfigValue(context.Background(), f, version, operator())
+		if err != nil {
+			log.Fatalf("failed to roll back %s: %v", f.Name, err)
+		}
+
+		log.Printf("Key %s has been rolled back to version %d (recorded as version %d) with value %s\n", f.Name, *e.RollbackOf, e.Version, f.Display(e.New))
 	},
 }
 
 func configLs() {
 	tb := table.NewWriter()
 	tb.SetOutputMirror(os.Stdout)
-	tb.AppendHeader(table.Row{"Config Key", "Redis Key"})
+	tb.AppendHeader(table.Row{"Config Key", "Redis Key", "Type", "Value"})
 
-	t := reflect.ValueOf(config.ApiConfig{})
-	for i := 0; i < t.NumField(); i++ {
-		typeField := t.Type().Field(i)
+	for _, f := range config.ApiConfigFields() {
+		v, isSet, err := config.GetApiConfigValue(context.Background(), f)
+		if err != nil {
+			log.Fatalf("failed to get %s: %v", f.Name, err)
+		}
 
-		tag := typeField.Tag
-		if tagg, ok := tag.Lookup("redis"); ok {
-			tb.AppendRow(table.Row{typeField.Name, tagg})
-		} else {
-			continue
+		v = truncateConfigValue(f.Display(v))
+		if !isSet {
+			v += " (default)"
 		}
 
+		tb.AppendRow(table.Row{f.Name, f.RedisKey, f.Type, v})
 	}
 	tb.Render()
 }
 
 func configGet(args []string) {
-	var apiConfig interface{}
-	apiConfig = &config.ApiConfiguration
 	tb := table.NewWriter()
 	tb.SetOutputMirror(os.Stdout)
 	tb.AppendHeader(table.Row{"Key", "Value"})
 
-	t := reflect.ValueOf(apiConfig)
-
 	for _, arg := range args {
-		valueField := t.Elem().FieldByName(arg)
-
-		if !valueField.IsValid() {
-			log.Fatalf("Invalid key: %s", arg)
+		f := lookupConfigField(arg)
+		v, _, err := config.GetApiConfigValue(context.Background(), f)
+		if err != nil {
+			log.Fatalf("failed to get %s: %v", f.Name, err)
 		}
 
-		valueFieldTypePtr := reflect.PtrTo(valueField.Type())
-		getMethod, _ := valueFieldTypePtr.MethodByName("Get")
+		tb.AppendRow(table.Row{f.Name, v})
+	}
+	tb.Render()
+}
+
+func configSet(key, value string) {
+	f := lookupConfigField(key)
+	if err := config.SetApiConfigValue(context.Background(), f, value, operator()); err != nil {
+		log.Fatalf("failed to set %s: %v", f.Name, err)
+	}
+
+	log.Printf("Key %s has been set with value %s\n", f.Name, f.Display(value))
+}
+
+func configHistory(f *config.ApiConfigField) {
+	entries, err := config.GetApiConfigHistory(context.Background(), f)
+	if err != nil {
+		log.Fatalf("failed to get the history of %s: %v", f.Name, err)
+	}
+
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Version", "At", "Who", "Old", "New", "Note"})
+	for _, e := range entries {
+		note := ""
+		if e.RollbackOf != nil {
+			note = "rollback to version " + strconv.FormatInt(*e.RollbackOf, 10)
+		}
 
-		tb.AppendRow(table.Row{arg, getMethod.Func.Call([]reflect.Value{valueField.Addr()})})
+		tb.AppendRow(table.Row{e.Version, e.At.Format(time.RFC3339), e.Who, truncateConfigValue(f.Display(e.Old)), truncateConfigValue(f.Display(e.New)), note})
 	}
 	tb.Render()
 }
 
-func configSet(args []string) {
-	t := reflect.ValueOf(config.ApiConfiguration)
+// lookupConfigField returns the field with the name, exiting if there is none.
+func lookupConfigField(name string) *config.ApiConfigField {
+	f, err := config.LookupApiConfigField(name)
+	if err != nil {
+		log.Fatalf("Invalid key: %s", name)
+	}
+
+	return f
+}
 
-	var typeField reflect.StructField
-	var ok bool
-	if typeField, ok = t.Type().FieldByName(args[0]); !ok {
-		log.Fatalf("Invalid key: %s", args[0])
+// getConfigValues returns the current values of all fields, exiting if they cannot be retrieved.
+func getConfigValues() map[string]string {
+	values, err := config.GetApiConfigValues(context.Background())
+	if err != nil {
+		log.Fatalf("failed to get config: %v", err)
 	}
 
-	var redisTag string
-	if redisTag, ok = typeField.Tag.Lookup("redis"); !ok {
-		log.Fatalf("Key %s cannot be set as it has no redis tag", args[0])
+	return values
+}
+
+// readConfigSnapshot reads a snapshot created by `config export`.
+func readConfigSnapshot(path string) map[string]string {
+	var snapshot map[string]string
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("failed to read %s: %v", path, err)
 	}
 
-	do := config.RedisClient.Set(context.Background(), redisTag, args[1], 0)
-	if do.Err() != nil {
-		log.Fatalf(do.Err().Error())
+	if err = json.Unmarshal(b, &snapshot); err != nil {
+		log.Fatalf("failed to parse %s: %v", path, err)
 	}
 
-	log.Printf("Key %s has been set with value %s\n", args[0], args[1])
+	return snapshot
+}
+
+// truncateConfigValue shortens values that are too long to be shown in a table.
+func truncateConfigValue(v string) string {
+	if r := []rune(v); len(r) > configLsMaxValueLength {
+		return string(r[:configLsMaxValueLength]) + "…"
+	}
+
+	return v
+}
+
+// renderConfigChanges prints the changes as a table, with the old & new values under the headers.
+func renderConfigChanges(changes []config.ApiConfigChange, oldHeader, newHeader string) {
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Key", oldHeader, newHeader})
+	for _, c := range changes {
+		tb.AppendRow(table.Row{c.Field.Name, c.Field.Display(c.Old), c.Field.Display(c.New)})
+	}
+	tb.Render()
 }
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/migrations"
+	"log"
+	"os"
+	"time"
+)
+
+func init() {
+	dbMigrateUpCmd.Flags().Int64("to", 0, "only apply migrations up to & including this version (defaults to all)")
+	dbMigrateDownCmd.Flags().Int("steps", 1, "the amount of migrations to revert")
+
+	dbMigrateCmd.AddCommand(dbMigrateUpCmd)
+	dbMigrateCmd.AddCommand(dbMigrateDownCmd)
+	dbMigrateCmd.AddCommand(dbMigrateStatusCmd)
+
+	dbCmd.AddCommand(dbMigrateCmd)
+
+	rootCmd.AddCommand(dbCmd)
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "manage the database of a shoya installation",
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "apply, revert & inspect the migrations of the database schema",
+}
+
+var dbMigrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "applies the pending migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetInt64("to")
+		initializeDB()
+
+		applied, err := migrations.Up(config.DB, to)
+		for _, m := range applied {
+			log.Printf("Applied migration %d (%s)\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("failed to migrate: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("The schema is already up to date")
+		}
+	},
+}
+
+var dbMigrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "reverts the most recently applied migrations (this may delete data)",
+	Run: func(cmd *cobra.Command, args []string) {
+		steps, _ := cmd.Flags().GetInt("steps")
+		if steps < 1 {
+			log.Fatalf("--steps has to be at least 1")
+		}
+		initializeDB()
+
+		reverted, err := migrations.Down(config.DB, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %d (%s)\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("failed to revert: %v", err)
+		}
+		if len(reverted) == 0 {
+			log.Println("There are no applied migrations to revert")
+		}
+	},
+}
+
+var dbMigrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "lists the migrations and whether they have been applied",
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		statuses, err := migrations.Statuses(config.DB)
+		if err != nil {
+			log.Fatalf("failed to get the status of the migrations: %v", err)
+		}
+
+		tb := table.NewWriter()
+		tb.SetOutputMirror(os.Stdout)
+		tb.AppendHeader(table.Row{"Version", "Name", "Status", "Applied At"})
+		for _, s := range statuses {
+			status, appliedAt := "pending", ""
+			if s.Applied {
+				status, appliedAt = "applied", time.Unix(s.AppliedAt, 0).UTC().Format(time.RFC3339)
+			}
+			if s.Unknown {
+				status = "applied (unknown to this build)"
+			}
+
+			tb.AppendRow(table.Row{s.Version, s.Name, status, appliedAt})
+		}
+		tb.Render()
+	},
+}
@@ -6,7 +6,11 @@ import (
 )
 
 func init() {
+	filesGc.Flags().Bool("dry-run", false, "only report what would be collected")
+	filesGc.Flags().Duration("interval", 0, "keep collecting periodically at this interval (e.g.: 6h)")
+
 	filesCmd.AddCommand(filesServe)
+	filesCmd.AddCommand(filesGc)
 
 	rootCmd.AddCommand(filesCmd)
 }
@@ -24,3 +28,13 @@ var filesServe = &cobra.Command{
 		files.Main()
 	},
 }
+
+var filesGc = &cobra.Command{
+	Use:   "gc",
+	Short: "garbage collect orphaned files, stuck uploads & unreferenced file versions",
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		files.GcMain(dryRun, interval)
+	},
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"log"
+	"os"
+	"strings"
+)
+
+func init() {
+	for _, c := range []*cobra.Command{infoPushAddCmd, infoPushEditCmd} {
+		c.Flags().Bool("enabled", false, "whether the push is shown")
+		c.Flags().String("release-status", "public", "the release status of the push")
+		c.Flags().Int("priority", 0, "the priority of the push (higher is shown first)")
+		c.Flags().StringSlice("tags", nil, "the tags of the push (comma-separated)")
+		c.Flags().String("data", "", "the data of the push (JSON object)")
+		c.Flags().String("data-file", "", "a file containing the data of the push (JSON object)")
+		c.Flags().String("start", "", "when the push starts being shown (RFC3339); empty to show it immediately")
+		c.Flags().String("end", "", "when the push stops being shown (RFC3339); empty to show it indefinitely")
+	}
+
+	infoPushCmd.AddCommand(infoPushLsCmd)
+	infoPushCmd.AddCommand(infoPushAddCmd)
+	infoPushCmd.AddCommand(infoPushEditCmd)
+	infoPushCmd.AddCommand(infoPushRmCmd)
+	infoPushCmd.AddCommand(infoPushEnableCmd)
+	infoPushCmd.AddCommand(infoPushDisableCmd)
+
+	rootCmd.AddCommand(infoPushCmd)
+}
+
+var infoPushCmd = &cobra.Command{
+	Use:   "infopush",
+	Short: "manage the pushes shown to users (InfoPush)",
+}
+
+var infoPushLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "lists all pushes, ordered by priority",
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		infoPushLs()
+	},
+}
+
+var infoPushAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "adds a push",
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		var p config.ApiInfoPush
+		applyInfoPushFlags(cmd.Flags(), &p)
+		created, err := models.CreateInfoPush(p, operator())
+		if err != nil {
+			log.Fatalf("failed to add push: %v", err)
+		}
+		log.Printf("Push %s has been added\n", created.Id)
+	},
+}
+
+var infoPushEditCmd = &cobra.Command{
+	Use:   "edit <id>",
+	Short: "changes the fields of a push that are passed as flags",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		infoPushUpdate(args[0], func(p *config.ApiInfoPush) {
+			applyInfoPushFlags(cmd.Flags(), p)
+		})
+	},
+}
+
+var infoPushRmCmd = &cobra.Command{
+	Use:   "rm <id>",
+	Short: "removes a push",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		if err := models.DeleteInfoPush(args[0], operator()); err != nil {
+			log.Fatalf("failed to remove push: %v", err)
+		}
+		log.Printf("Push %s has been removed\n", args[0])
+	},
+}
+
+var infoPushEnableCmd = &cobra.Command{
+	Use:   "enable <id>",
+	Short: "enables a push",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		infoPushUpdate(args[0], func(p *config.ApiInfoPush) {
+			p.IsEnabled = true
+		})
+	},
+}
+
+var infoPushDisableCmd = &cobra.Command{
+	Use:   "disable <id>",
+	Short: "disables a push",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		infoPushUpdate(args[0], func(p *config.ApiInfoPush) {
+			p.IsEnabled = false
+		})
+	},
+}
+
+func infoPushLs() {
+	pushes, err := models.GetInfoPushes()
+	if err != nil {
+		log.Fatalf("failed to list pushes: %v", err)
+	}
+
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Id", "Enabled", "Priority", "Release Status", "Tags", "Start", "End", "Updated At"})
+	for _, p := range pushes {
+		tb.AppendRow(table.Row{p.Id, p.IsEnabled, p.Priority, p.ReleaseStatus, strings.Join(p.Tags, ","), p.StartDate, p.EndDate, p.UpdatedAt})
+	}
+	tb.Render()
+}
+
+func infoPushUpdate(id string, fn func(p *config.ApiInfoPush)) {
+	if _, err := models.UpdateInfoPush(id, operator(), fn); err != nil {
+		log.Fatalf("failed to update push: %v", err)
+	}
+	log.Printf("Push %s has been updated\n", id)
+}
+
+// applyInfoPushFlags copies the flags that were passed onto the push.
+func applyInfoPushFlags(f *pflag.FlagSet, p *config.ApiInfoPush) {
+	if f.Changed("enabled") {
+		p.IsEnabled, _ = f.GetBool("enabled")
+	}
+	if f.Changed("release-status") {
+		p.ReleaseStatus, _ = f.GetString("release-status")
+	}
+	if f.Changed("priority") {
+		p.Priority, _ = f.GetInt("priority")
+	}
+	if f.Changed("tags") {
+		p.Tags, _ = f.GetStringSlice("tags")
+	}
+	if f.Changed("start") {
+		p.StartDate, _ = f.GetString("start")
+	}
+	if f.Changed("end") {
+		p.EndDate, _ = f.GetString("end")
+	}
+
+	var data []byte
+	if f.Changed("data") {
+		s, _ := f.GetString("data")
+		data = []byte(s)
+	} else if f.Changed("data-file") {
+		path, _ := f.GetString("data-file")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read data file: %v", err)
+		}
+		data = b
+	}
+
+	if data != nil {
+		if err := json.Unmarshal(data, &p.Data); err != nil {
+			log.Fatalf("data is not a valid JSON object: %v", err)
+		}
+	}
+}
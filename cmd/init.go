@@ -0,0 +1,484 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gitlab.com/george/shoya-go/config"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"gitlab.com/george/shoya-go/migrations"
+	"gitlab.com/george/shoya-go/models"
+	"gitlab.com/george/shoya-go/services/api"
+	"gitlab.com/george/shoya-go/services/files/files_client"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// insecureSecretSeed is the seed of the secrets in ApiConfig, which `shoya init` replaces with generated values.
+const insecureSecretSeed = "INSECURE_CHANGEME"
+
+// initStaffTags are the tags the staff user created by `shoya init` is given.
+var initStaffTags = []string{"admin_moderator", "admin_avatar_access"}
+
+func init() {
+	initCmd.Flags().String("username", "admin", "the username of the staff user")
+	initCmd.Flags().String("display-name", "", "the display name of the staff user (defaults to the username)")
+	initCmd.Flags().String("email", "", "the email address of the staff user")
+	initCmd.Flags().String("avatar-id", "", "the id of the default avatar, which must match the one baked into its bundle (avtr_...)")
+	initCmd.Flags().String("avatar-name", "Default Avatar", "the name of the default avatar")
+	initCmd.Flags().String("avatar-bundle", "", "the path of the bundle of the default avatar (.vrca)")
+	initCmd.Flags().String("avatar-image", "", "the path of the image of the default avatar (.png, .jpg)")
+	initCmd.Flags().String("world-id", "", "the id of the home world, which must match the one baked into its bundle (wrld_...)")
+	initCmd.Flags().String("world-name", "Home", "the name of the home world")
+	initCmd.Flags().String("world-bundle", "", "the path of the bundle of the home world (.vrcw)")
+	initCmd.Flags().String("world-image", "", "the path of the image of the home world (.png, .jpg)")
+	initCmd.Flags().String("tutorial-world-id", "", "the id of an existing tutorial world (defaults to the home world)")
+	initCmd.Flags().String("platform", string(models.PlatformWindows), "the platform the bundles were built for")
+	initCmd.Flags().String("unity-version", "2019.4.31f1", "the unity version the bundles were built with")
+	initCmd.Flags().Int("asset-version", 1, "the asset version of the bundles")
+
+	for _, f := range []string{"avatar-id", "avatar-bundle", "avatar-image", "world-id", "world-bundle", "world-image"} {
+		_ = initCmd.MarkFlagRequired(f)
+	}
+
+	rootCmd.AddCommand(initCmd)
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "bootstraps a fresh installation with a staff user, a default avatar, a home world & generated secrets",
+	Long: `Bootstraps a fresh installation. The avatar & world bundles are uploaded through the files service, the staff user
+is created with a generated password, the config keys pointing at them are set, and the secrets that still have their
+insecure seeds are replaced with generated values. The database has to be migrated first (see "shoya db migrate up").`,
+	Run: func(cmd *cobra.Command, args []string) {
+		o := initOptionsFromFlags(cmd)
+
+		initializeRedis()
+		initializeApiConfig()
+		initializeDB()
+
+		if err := migrations.Check(config.DB); err != nil {
+			log.Fatalf("%v (run `shoya db migrate up` first)", err)
+		}
+
+		if err := initInstallation(o); err != nil {
+			log.Fatalf("failed to initialize: %v", err)
+		}
+	},
+}
+
+// initOptions are the options of `shoya init`.
+type initOptions struct {
+	Username, DisplayName, Email                    string
+	AvatarId, AvatarName, AvatarBundle, AvatarImage string
+	WorldId, WorldName, WorldBundle, WorldImage     string
+	TutorialWorldId                                 string
+	Platform                                        models.Platform
+	UnityVersion                                    string
+	AssetVersion                                    int
+}
+
+func initOptionsFromFlags(cmd *cobra.Command) *initOptions {
+	var o initOptions
+	fs := cmd.Flags()
+
+	o.Username, _ = fs.GetString("username")
+	o.DisplayName, _ = fs.GetString("display-name")
+	o.Email, _ = fs.GetString("email")
+	o.AvatarId, _ = fs.GetString("avatar-id")
+	o.AvatarName, _ = fs.GetString("avatar-name")
+	o.AvatarBundle, _ = fs.GetString("avatar-bundle")
+	o.AvatarImage, _ = fs.GetString("avatar-image")
+	o.WorldId, _ = fs.GetString("world-id")
+	o.WorldName, _ = fs.GetString("world-name")
+	o.WorldBundle, _ = fs.GetString("world-bundle")
+	o.WorldImage, _ = fs.GetString("world-image")
+	o.TutorialWorldId, _ = fs.GetString("tutorial-world-id")
+	o.UnityVersion, _ = fs.GetString("unity-version")
+	o.AssetVersion, _ = fs.GetInt("asset-version")
+
+	platform, _ := fs.GetString("platform")
+	o.Platform = models.Platform(platform)
+
+	if o.DisplayName == "" {
+		o.DisplayName = o.Username
+	}
+	if o.TutorialWorldId == "" {
+		o.TutorialWorldId = o.WorldId
+	}
+
+	if !strings.HasPrefix(o.AvatarId, "avtr_") {
+		log.Fatalf("invalid avatar id %q: avatar ids start with avtr_", o.AvatarId)
+	}
+	if !strings.HasPrefix(o.WorldId, "wrld_") {
+		log.Fatalf("invalid world id %q: world ids start with wrld_", o.WorldId)
+	}
+	if !strings.HasPrefix(o.TutorialWorldId, "wrld_") {
+		log.Fatalf("invalid tutorial world id %q: world ids start with wrld_", o.TutorialWorldId)
+	}
+	if o.Platform != models.PlatformWindows && o.Platform != models.PlatformAndroid {
+		log.Fatalf("invalid platform %q: expected %s or %s", platform, models.PlatformWindows, models.PlatformAndroid)
+	}
+
+	return &o
+}
+
+// initInstallation creates the staff user, the default avatar & the home world, and then points the config at them. The
+// database is left untouched if any part of it fails; uploaded objects are deleted again.
+func initInstallation(o *initOptions) error {
+	if config.ApiConfiguration.DefaultAvatar.Get() != "" || config.ApiConfiguration.HomeWorldId.Get() != "" {
+		return errors.New("the installation is already initialized (DefaultAvatar or HomeWorldId is set)")
+	}
+
+	var n int64
+	if err := config.DB.Model(&models.User{}).Where("username = ?", strings.ToLower(o.Username)).Count(&n).Error; err != nil {
+		return err
+	}
+	if n != 0 {
+		return fmt.Errorf("a user named %s already exists", o.Username)
+	}
+
+	// The tutorial world is only imported when it is the home world; any other has to exist already.
+	if o.TutorialWorldId != o.WorldId {
+		if err := config.DB.Model(&models.World{}).Where("id = ?", o.TutorialWorldId).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("the tutorial world %s does not exist (omit --tutorial-world-id to use the home world)", o.TutorialWorldId)
+		}
+	}
+
+	fs, err := api.DialFilesService(config.ApiConfiguration.FilesEndpoint.Get(), config.RuntimeConfig.Api.Files)
+	if err != nil {
+		return err
+	}
+
+	password, err := generateSecret(18)
+	if err != nil {
+		return err
+	}
+
+	// The user is created last, as it references the avatar & world, which in turn are authored by it.
+	u := models.NewUser(o.Username, o.DisplayName, o.Email, password)
+	u.ID = "usr_" + uuid.New().String()
+	u.CurrentAvatarID, u.FallbackAvatarID, u.HomeWorldID = o.AvatarId, o.AvatarId, o.WorldId
+	u.Tags = initStaffTags
+
+	im := &bundleImporter{files: fs, ownerId: u.ID}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		im.tx = tx
+
+		avatarImage, _, err := im.importFile(o.AvatarImage)
+		if err != nil {
+			return err
+		}
+
+		avatarBundle, avatarVersion, err := im.importFile(o.AvatarBundle)
+		if err != nil {
+			return err
+		}
+
+		a := models.Avatar{AuthorID: u.ID, Name: o.AvatarName, ImageID: avatarImage.ID, ReleaseStatus: models.ReleaseStatusPublic}
+		a.ID = o.AvatarId
+		if err = tx.Omit(clause.Associations).Create(&a).Error; err != nil {
+			return err
+		}
+
+		err = tx.Omit(clause.Associations).Create(&models.AvatarUnityPackage{
+			BelongsToAssetID: a.ID,
+			FileID:           avatarBundle.ID,
+			FileVersion:      avatarVersion.Version,
+			Version:          o.AssetVersion,
+			Platform:         o.Platform,
+			UnityVersion:     o.UnityVersion,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		worldImage, _, err := im.importFile(o.WorldImage)
+		if err != nil {
+			return err
+		}
+
+		worldBundle, worldVersion, err := im.importFile(o.WorldBundle)
+		if err != nil {
+			return err
+		}
+
+		w := models.World{AuthorID: u.ID, Name: o.WorldName, ImageID: worldImage.ID, ReleaseStatus: models.ReleaseStatusPublic}
+		w.ID = o.WorldId
+		if err = tx.Omit(clause.Associations).Create(&w).Error; err != nil {
+			return err
+		}
+
+		err = tx.Omit(clause.Associations).Create(&models.WorldUnityPackage{
+			BelongsToAssetID: w.ID,
+			FileID:           worldBundle.ID,
+			FileVersion:      worldVersion.Version,
+			Version:          o.AssetVersion,
+			Platform:         o.Platform,
+			UnityVersion:     o.UnityVersion,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Omit(clause.Associations).Create(u).Error
+	})
+	if err != nil {
+		im.cleanup()
+		return err
+	}
+
+	values := map[string]string{
+		"DefaultAvatar":   o.AvatarId,
+		"HomeWorldId":     o.WorldId,
+		"TutorialWorldId": o.TutorialWorldId,
+	}
+
+	generated, err := generateInsecureSecrets(values)
+	if err != nil {
+		return err
+	}
+
+	if err = config.SetApiConfigValues(context.Background(), values, operator()); err != nil {
+		return fmt.Errorf("the user, avatar & world were created, but the config could not be updated: %w", err)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Key", "Value"})
+	t.AppendRows([]table.Row{
+		{"User", fmt.Sprintf("%s (%s)", u.Username, u.ID)},
+		{"Password", password},
+		{"DefaultAvatar", o.AvatarId},
+		{"HomeWorldId", o.WorldId},
+		{"TutorialWorldId", o.TutorialWorldId},
+	})
+	for _, name := range generated {
+		t.AppendRow(table.Row{name, "generated"})
+	}
+	t.Render()
+
+	if contains(generated, "DiscoveryServiceApiKey") {
+		fmt.Printf("\nThe discovery service has to be configured with the generated API key as its discoveryApiKey:\n%s\n", values["DiscoveryServiceApiKey"])
+	}
+	if contains(generated, "PhotonSecret") {
+		fmt.Printf("\nThe Photon server's custom authentication has to send the generated secret as its secret parameter:\n%s\n", values["PhotonSecret"])
+	}
+
+	fmt.Println("\nThe password is not shown again; store it somewhere safe, or change it after logging in.")
+	return nil
+}
+
+// generateInsecureSecrets adds generated values for the secrets that still have their insecure seed to the values, and
+// returns the names of the generated ones. The discovery service's key is reused if it is configured in this config.
+func generateInsecureSecrets(values map[string]string) ([]string, error) {
+	var generated []string
+	for _, name := range []string{"JwtSecret", "PhotonSecret", "DiscoveryServiceApiKey"} {
+		f, err := config.LookupApiConfigField(name)
+		if err != nil {
+			return nil, err
+		}
+
+		v, _, err := config.GetApiConfigValue(context.Background(), f)
+		if err != nil {
+			return nil, err
+		}
+
+		if v != insecureSecretSeed {
+			continue
+		}
+
+		if d := config.RuntimeConfig.Discovery; name == "DiscoveryServiceApiKey" && d != nil && d.DiscoveryApiKey != "" && d.DiscoveryApiKey != insecureSecretSeed {
+			values[name] = d.DiscoveryApiKey
+			continue
+		}
+
+		if values[name], err = generateSecret(48); err != nil {
+			return nil, err
+		}
+		generated = append(generated, name)
+	}
+
+	return generated, nil
+}
+
+// generateSecret returns n random bytes, encoded as (URL-safe) base64.
+func generateSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// bundleImporter uploads local files through the files service, and creates the file records for them the same way
+// finished uploads through the API do.
+type bundleImporter struct {
+	files    pb.FileClient
+	tx       *gorm.DB
+	ownerId  string
+	uploaded []string // The objects uploaded so far, which are deleted again if the import fails.
+}
+
+// importFile uploads the file at the path, and returns its (complete) file record & version.
+func (im *bundleImporter) importFile(path string) (*models.File, *models.FileVersion, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if !contains(models.FileAllowedExtensions, ext) {
+		return nil, nil, fmt.Errorf("%s: unsupported file extension (expected one of %s)", path, strings.Join(models.FileAllowedExtensions, ", "))
+	}
+
+	mimeType := mime.TypeByExtension(ext)
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	h := md5.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f := models.File{OwnerID: im.ownerId, Name: filepath.Base(path), MimeType: mimeType, Extension: ext}
+	if err = im.tx.Omit(clause.Associations).Create(&f).Error; err != nil {
+		return nil, nil, err
+	}
+
+	fd := models.FileDescriptor{
+		FileID:      f.ID,
+		Type:        models.FileDescriptorTypeFile,
+		Status:      models.FileUploadStatusComplete,
+		Category:    models.FileUploadCategorySimple,
+		SizeInBytes: int(size),
+		FileName:    fmt.Sprintf("%s.%s.%d%s", objectNamePrefix(f.Name), f.ID, 1, ext),
+		Md5:         base64.StdEncoding.EncodeToString(h.Sum(nil)),
+	}
+	if size > models.FileMultipartUploadThreshold {
+		fd.Category = models.FileUploadCategoryMultipart
+	}
+
+	sha256, err := im.upload(r, &fd, mimeType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// The delta & signature are not generated; clients download imported bundles in full.
+	delta := models.FileDescriptor{FileID: f.ID, Type: models.FileDescriptorTypeDelta, Status: models.FileUploadStatusNone, Category: models.FileUploadCategoryQueued}
+	signature := models.FileDescriptor{FileID: f.ID, Type: models.FileDescriptorTypeSignature, Status: models.FileUploadStatusNone, Category: models.FileUploadCategorySimple}
+	for _, d := range []*models.FileDescriptor{&fd, &delta, &signature} {
+		if err = im.tx.Create(d).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	object, err := models.LinkFileObject(im.tx, &fd, sha256)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The contents were already present in storage, so the uploaded copy is no longer needed.
+	if object != fd.FileName {
+		im.deleteObject(fd.FileName)
+	}
+
+	fv := models.FileVersion{
+		FileID:                f.ID,
+		Version:               1,
+		Status:                models.FileUploadStatusComplete,
+		FileDescriptorID:      fd.ID,
+		DeltaDescriptorID:     delta.ID,
+		SignatureDescriptorID: signature.ID,
+	}
+	if err = im.tx.Omit(clause.Associations).Create(&fv).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &f, &fv, nil
+}
+
+// upload uploads the contents of the file to the object of the descriptor, and verifies the object that ended up in
+// storage. The SHA-256 of the object is returned.
+func (im *bundleImporter) upload(r io.ReaderAt, fd *models.FileDescriptor, contentType string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	etags, err := files_client.Upload(ctx, im.files, fd.FileName, r, int64(fd.SizeInBytes), fd.Md5, contentType)
+	if err != nil {
+		return "", err
+	}
+	fd.PartETags = etags
+	im.uploaded = append(im.uploaded, fd.FileName)
+
+	st, err := im.files.StatFile(ctx, &pb.StatFileRequest{Name: &fd.FileName})
+	if err != nil {
+		return "", err
+	}
+
+	sum, err := im.files.HashFile(ctx, &pb.HashFileRequest{Name: &fd.FileName})
+	if err != nil {
+		return "", err
+	}
+
+	if !st.GetExists() || st.GetSize() != int64(fd.SizeInBytes) || !fd.MatchesMd5(sum.GetMd5()) {
+		return "", errors.New("upload verification failed: the object in storage does not match the file")
+	}
+
+	return sum.GetSha256(), nil
+}
+
+// cleanup deletes the objects uploaded by the importer.
+func (im *bundleImporter) cleanup() {
+	for _, name := range im.uploaded {
+		im.deleteObject(name)
+	}
+}
+
+func (im *bundleImporter) deleteObject(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := im.files.DeleteFile(ctx, &pb.DeleteFileRequest{Name: &name}); err != nil {
+		log.Printf("failed to delete object %s: %v", name, err)
+	}
+}
+
+// objectNamePrefix returns the name of a file the way it prefixes the names of its objects.
+func objectNamePrefix(name string) string {
+	name = strings.ReplaceAll(name, " ", "-")
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	return name
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"log"
+	"os"
+	"time"
+)
+
+func init() {
+	for _, c := range []*cobra.Command{moderationBanCmd, moderationWarnCmd} {
+		c.Flags().String("reason", "", "the reason shown to the user")
+		c.Flags().String("expires", "", "when the moderation expires, in natural language (e.g.: \"in 2 weeks\")")
+		c.Flags().Bool("permanent", false, "never expire the moderation")
+		c.Flags().String("source", "", "the staff user the moderation is issued by")
+	}
+	moderationWarnCmd.Flags().String("world", "", "the id of the world the warning was issued in")
+	moderationWarnCmd.Flags().String("instance", "", "the id of the instance the warning was issued in")
+	moderationListCmd.Flags().Bool("all", false, "include expired moderations")
+
+	moderationCmd.AddCommand(moderationBanCmd)
+	moderationCmd.AddCommand(moderationUnbanCmd)
+	moderationCmd.AddCommand(moderationWarnCmd)
+	moderationCmd.AddCommand(moderationListCmd)
+
+	rootCmd.AddCommand(moderationCmd)
+}
+
+var moderationCmd = &cobra.Command{
+	Use:   "moderation",
+	Short: "manage the moderations of users directly in the database",
+}
+
+var moderationBanCmd = &cobra.Command{
+	Use:   "ban <user>",
+	Short: "bans a user, either until --expires or --permanent(ly)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		moderationCreate(cmd, lookupUser(args[0]), models.ModerationBan)
+	},
+}
+
+var moderationUnbanCmd = &cobra.Command{
+	Use:   "unban <user>",
+	Short: "lifts the active bans of a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		u := lookupUser(args[0])
+
+		n, err := models.LiftBans(u.ID)
+		if err != nil {
+			log.Fatalf("failed to unban user: %v", err)
+		}
+
+		log.Printf("%d ban(s) of %s have been lifted\n", n, u.Username)
+	},
+}
+
+var moderationWarnCmd = &cobra.Command{
+	Use:   "warn <user>",
+	Short: "warns a user, either until --expires or --permanent(ly)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		moderationCreate(cmd, lookupUser(args[0]), models.ModerationWarn)
+	},
+}
+
+var moderationListCmd = &cobra.Command{
+	Use:   "list <user>",
+	Short: "lists the active moderations of a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		initializeDB()
+		mods, err := models.GetModerations(lookupUser(args[0]).ID, all)
+		if err != nil {
+			log.Fatalf("failed to get moderations: %v", err)
+		}
+
+		renderModerations(mods)
+	},
+}
+
+func moderationCreate(cmd *cobra.Command, u *models.User, t models.ModerationType) {
+	reason, _ := cmd.Flags().GetString("reason")
+	expires, _ := cmd.Flags().GetString("expires")
+	permanent, _ := cmd.Flags().GetBool("permanent")
+	source, _ := cmd.Flags().GetString("source")
+
+	if permanent == (expires != "") {
+		log.Fatalf("either --expires or --permanent has to be given")
+	}
+
+	var exp = time.Unix(0, 0) // If expiry is `0`, we'll assume it's permanent.
+	if !permanent {
+		var err error
+		if exp, err = models.ParseModerationExpiry(expires, time.Now()); err != nil {
+			log.Fatalf("invalid expiry %q: %v", expires, err)
+		}
+	}
+
+	mod := &models.Moderation{
+		TargetID:  u.ID,
+		Type:      t,
+		Reason:    reason,
+		ExpiresAt: exp.Unix(),
+	}
+
+	if source != "" {
+		mod.SourceID = lookupUser(source).ID
+	}
+
+	if t == models.ModerationWarn {
+		mod.WorldID, _ = cmd.Flags().GetString("world")
+		mod.InstanceID, _ = cmd.Flags().GetString("instance")
+	}
+
+	if err := config.DB.Create(mod).Error; err != nil {
+		log.Fatalf("failed to create moderation: %v", err)
+	}
+
+	log.Printf("Moderation %s (%s) has been created for %s\n", mod.ID, mod.Type, u.Username)
+}
+
+func renderModerations(mods []models.Moderation) {
+	now := time.Now()
+
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Id", "Type", "Reason", "Source", "Created At", "Expires At", "Active"})
+	for _, m := range mods {
+		expires := "never"
+		if m.ExpiresAt != 0 {
+			expires = time.Unix(m.ExpiresAt, 0).UTC().Format(time.RFC3339)
+		}
+
+		tb.AppendRow(table.Row{m.ID, m.Type, m.Reason, m.SourceID, time.Unix(m.CreatedAt, 0).UTC().Format(time.RFC3339), expires, m.IsActive(now)})
+	}
+	tb.Render()
+}
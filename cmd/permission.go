@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"gitlab.com/george/shoya-go/models"
+	"log"
+)
+
+func init() {
+	permissionCmd.AddCommand(permissionGrantCmd)
+	permissionCmd.AddCommand(permissionRevokeCmd)
+
+	rootCmd.AddCommand(permissionCmd)
+}
+
+var permissionCmd = &cobra.Command{
+	Use:   "permission",
+	Short: "manage the permissions of users directly in the database",
+}
+
+var permissionGrantCmd = &cobra.Command{
+	Use:   "grant <user> <permission>",
+	Short: "grants a permission to a user",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		u := lookupUser(args[0])
+
+		if _, err := models.GrantPermission(u.ID, args[1], operator()); err != nil {
+			log.Fatalf("failed to grant permission: %v", err)
+		}
+
+		log.Printf("Permission %s has been granted to %s\n", args[1], u.Username)
+	},
+}
+
+var permissionRevokeCmd = &cobra.Command{
+	Use:   "revoke <user> <permission>",
+	Short: "revokes a permission from a user",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		u := lookupUser(args[0])
+
+		if err := models.RevokePermission(u.ID, args[1]); err != nil {
+			log.Fatalf("failed to revoke permission: %v", err)
+		}
+
+		log.Printf("Permission %s has been revoked from %s\n", args[1], u.Username)
+	},
+}
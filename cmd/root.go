@@ -8,10 +8,10 @@ import (
 	"os"
 )
 
-var ConfigLocation string
+var ConfigLocations []string
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&ConfigLocation, "config", "c", "config.json", "The location of the config file")
+	rootCmd.PersistentFlags().StringSliceVarP(&ConfigLocations, "config", "c", nil, "The location of the config file (JSON, YAML or TOML); repeat it to layer several files, later ones overriding earlier ones. Defaults to ./config.json, ./config.yaml, ./config.yml or ./config.toml if they exist")
 }
 
 var rootCmd = &cobra.Command{
@@ -19,8 +19,7 @@ var rootCmd = &cobra.Command{
 	Short: "An API emulator for VRChat",
 	Long:  `Shoya is an API emulator ("private server") for the popular VR social game, VRChat.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		ConfigLocation = cmd.Flag("config").Value.String()
-		err := config.LoadConfig(ConfigLocation)
+		err := config.LoadConfig(ConfigLocations...)
 		if err != nil {
 			log.Fatalf("%+v", err)
 		}
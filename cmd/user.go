@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	userCreateCmd.Flags().String("email", "", "the email address of the user")
+	userCreateCmd.Flags().String("display-name", "", "the display name of the user (defaults to the username)")
+	userCreateCmd.Flags().String("password", "", "the password of the user (generated if empty)")
+	userCreateCmd.Flags().Bool("staff", false, "make the user a staff member (admin_moderator)")
+	userPasswdCmd.Flags().String("password", "", "the new password (generated if empty)")
+
+	userCmd.AddCommand(userCreateCmd)
+	userCmd.AddCommand(userGetCmd)
+	userCmd.AddCommand(userPasswdCmd)
+	userCmd.AddCommand(userTagCmd)
+	userCmd.AddCommand(userUntagCmd)
+	userCmd.AddCommand(userSetDeveloperTypeCmd)
+
+	rootCmd.AddCommand(userCmd)
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "manage users directly in the database",
+	Long:  "Manage users directly in the database, e.g.: when the API is down or there is no staff account yet. Users can be referred to by id, username or email.",
+}
+
+var userCreateCmd = &cobra.Command{
+	Use:   "create <username>",
+	Short: "creates a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		email, _ := cmd.Flags().GetString("email")
+		displayName, _ := cmd.Flags().GetString("display-name")
+		password, _ := cmd.Flags().GetString("password")
+		staff, _ := cmd.Flags().GetBool("staff")
+
+		initializeRedis()
+		initializeApiConfig()
+		initializeDB()
+		userCreate(args[0], displayName, email, password, staff)
+	},
+}
+
+var userGetCmd = &cobra.Command{
+	Use:   "get <user>",
+	Short: "shows a user, along with their permissions & active moderations",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		userGet(lookupUser(args[0]))
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <user>",
+	Short: "changes the password of a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		password, _ := cmd.Flags().GetString("password")
+
+		initializeDB()
+		userPasswd(lookupUser(args[0]), password)
+	},
+}
+
+var userTagCmd = &cobra.Command{
+	Use:   "tag <user> <tag>...",
+	Short: "adds tags to a user (e.g.: admin_moderator, system_avatar_access)",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		userUpdateTags(lookupUser(args[0]), args[1:], nil)
+	},
+}
+
+var userUntagCmd = &cobra.Command{
+	Use:   "untag <user> <tag>...",
+	Short: "removes tags from a user",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		userUpdateTags(lookupUser(args[0]), nil, args[1:])
+	},
+}
+
+var userSetDeveloperTypeCmd = &cobra.Command{
+	Use:   "set-developer-type <user> <type>",
+	Short: "sets the developer type of a user (" + strings.Join(models.UserDeveloperTypes, ", ") + ")",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeDB()
+		userSetDeveloperType(lookupUser(args[0]), args[1])
+	},
+}
+
+// lookupUser returns the user with the id, username or email, and exits if there is none.
+func lookupUser(s string) *models.User {
+	var u *models.User
+	var err error
+
+	if strings.HasPrefix(s, "usr_") {
+		u, err = models.GetUserById(s)
+	} else {
+		u, err = models.GetUserByUsernameOrEmail(strings.ToLower(s))
+	}
+
+	if err != nil {
+		log.Fatalf("failed to get user %s: %v", s, err)
+	}
+
+	return u
+}
+
+func userCreate(username, displayName, email, password string, staff bool) {
+	var generated bool
+	var err error
+
+	if displayName == "" {
+		displayName = username
+	}
+
+	if len(username) < 3 || len(username) > 32 {
+		log.Fatalf("username must be between 3 and 32 characters")
+	}
+
+	if config.ApiConfiguration.DefaultAvatar.Get() == "" || config.ApiConfiguration.HomeWorldId.Get() == "" {
+		log.Fatalf("DefaultAvatar & HomeWorldId have to be set before users can be created (see `shoya init`)")
+	}
+
+	if password == "" {
+		if password, err = generateSecret(18); err != nil {
+			log.Fatalf("failed to generate password: %v", err)
+		}
+		generated = true
+	} else if len(password) < 8 {
+		log.Fatalf("failed to create user: %v (at least 8 characters are required)", models.ErrPasswordTooSmall)
+	}
+
+	q := config.DB.Where("username = ?", strings.ToLower(username)).Or("display_name = ?", displayName)
+	if email != "" {
+		q = q.Or("email = ?", strings.ToLower(email))
+	}
+
+	if err = q.First(&models.User{}).Error; err != gorm.ErrRecordNotFound {
+		if err != nil {
+			log.Fatalf("failed to create user: %v", err)
+		}
+		log.Fatalf("username, display name, or email already exists")
+	}
+
+	u := models.NewUser(username, displayName, email, password)
+	if staff {
+		u.Tags = pq.StringArray{"admin_moderator"}
+	}
+
+	if err = config.DB.Omit(clause.Associations).Create(u).Error; err != nil {
+		log.Fatalf("failed to create user: %v", err)
+	}
+
+	log.Printf("User %s has been created with id %s\n", u.Username, u.ID)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+}
+
+func userGet(u *models.User) {
+	banned, _ := u.IsBanned()
+	var permissions []string
+	for _, p := range u.Permissions {
+		permissions = append(permissions, p.Name)
+	}
+
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Key", "Value"})
+	tb.AppendRows([]table.Row{
+		{"Id", u.ID},
+		{"Username", u.Username},
+		{"Display Name", u.DisplayName},
+		{"Email", u.Email},
+		{"Developer Type", u.DeveloperType},
+		{"Tags", strings.Join(u.Tags, ",")},
+		{"Permissions", strings.Join(permissions, ",")},
+		{"Staff", u.IsStaff()},
+		{"Banned", banned},
+		{"Created At", time.Unix(u.CreatedAt, 0).UTC().Format(time.RFC3339)},
+	})
+	tb.Render()
+
+	mods, err := models.GetModerations(u.ID, false)
+	if err != nil {
+		log.Fatalf("failed to get moderations: %v", err)
+	}
+
+	if len(mods) != 0 {
+		renderModerations(mods)
+	}
+}
+
+func userPasswd(u *models.User, password string) {
+	var generated bool
+	var err error
+
+	if password == "" {
+		if password, err = generateSecret(18); err != nil {
+			log.Fatalf("failed to generate password: %v", err)
+		}
+		generated = true
+	} else if len(password) < 8 {
+		log.Fatalf("failed to change password: %v (at least 8 characters are required)", models.ErrPasswordTooSmall)
+	}
+
+	if err = u.ChangePassword(password); err != nil {
+		log.Fatalf("failed to change password: %v", err)
+	}
+
+	if err = config.DB.Model(&models.User{}).Where("id = ?", u.ID).Update("password", u.Password).Error; err != nil {
+		log.Fatalf("failed to change password: %v", err)
+	}
+
+	log.Printf("The password of %s has been changed\n", u.Username)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+}
+
+// userUpdateTags adds & removes tags of the user. Unlike the API, any tag can be added (including system_ & admin_ ones).
+func userUpdateTags(u *models.User, add, remove []string) {
+	var tags = pq.StringArray{}
+	for _, t := range u.Tags {
+		if !contains(remove, t) && !contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+
+	for _, t := range add {
+		if !contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", u.ID).Update("tags", tags).Error; err != nil {
+		log.Fatalf("failed to update tags: %v", err)
+	}
+
+	log.Printf("The tags of %s have been updated: %s\n", u.Username, strings.Join(tags, ","))
+}
+
+func userSetDeveloperType(u *models.User, developerType string) {
+	if !contains(models.UserDeveloperTypes, developerType) {
+		log.Fatalf("%v: %s (expected one of %s)", models.ErrInvalidDeveloperType, developerType, strings.Join(models.UserDeveloperTypes, ", "))
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", u.ID).Update("developer_type", developerType).Error; err != nil {
+		log.Fatalf("failed to set developer type: %v", err)
+	}
+
+	log.Printf("The developer type of %s has been set to %s\n", u.Username, developerType)
+}
@@ -6,11 +6,18 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/gtsatsis/harvester"
 	"gitlab.com/george/shoya-go/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+	"log"
+	"os"
+	"os/user"
 	"time"
 )
 
 // initializeRedis initializes the redis clients
 func initializeRedis() {
+	requireApiConfig()
 	config.RedisClient = redis.NewClient(&redis.Options{
 		Addr:     config.RuntimeConfig.Api.Redis.Host,
 		Password: config.RuntimeConfig.Api.Redis.Password,
@@ -44,3 +51,44 @@ func initializeApiConfig() {
 		panic(fmt.Errorf("failed to harvest configuration: %v", err))
 	}
 }
+
+// initializeDB initializes the database connection of the API. Migrations are left to `shoya db migrate`.
+func initializeDB() {
+	requireApiConfig()
+
+	var err error
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Etc/GMT",
+		config.RuntimeConfig.Api.Postgres.Host,
+		config.RuntimeConfig.Api.Postgres.User,
+		config.RuntimeConfig.Api.Postgres.Password,
+		config.RuntimeConfig.Api.Postgres.Database,
+		config.RuntimeConfig.Api.Postgres.Port)
+	config.DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Silent),
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// requireApiConfig exits if the api section of the config, which the CLI connects to Redis & the database with, is
+// incomplete.
+func requireApiConfig() {
+	if err := config.RuntimeConfig.Require("api"); err != nil {
+		log.Fatalf("error reading config: %v", err)
+	}
+}
+
+// operator returns the name changes made through the CLI are recorded under in the config history (user@host).
+func operator() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+
+	return name
+}
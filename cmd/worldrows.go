@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"log"
+	"os"
+	"strconv"
+)
+
+func init() {
+	for _, c := range []*cobra.Command{worldRowsAddCmd, worldRowsEditCmd} {
+		c.Flags().String("name", "", "the name of the row")
+		c.Flags().String("sort", "", "what the row is sorted by: popular, new, updated, staffpicks, name or shuffle")
+		c.Flags().String("order", "descending", "the order of the row: ascending or descending")
+		c.Flags().String("ownership", "any", "whose worlds the row shows: any or mine")
+		c.Flags().String("platform", "ThisPlatformSupported", "the platform of the row")
+		c.Flags().String("tag", "", "only show worlds with this tag")
+	}
+
+	worldStaffPicksAddCmd.Flags().Int("position", -1, "the position to add the world at (defaults to last)")
+
+	worldStaffPicksCmd.AddCommand(worldStaffPicksLsCmd)
+	worldStaffPicksCmd.AddCommand(worldStaffPicksAddCmd)
+	worldStaffPicksCmd.AddCommand(worldStaffPicksRmCmd)
+
+	worldRowsCmd.AddCommand(worldRowsLsCmd)
+	worldRowsCmd.AddCommand(worldRowsAddCmd)
+	worldRowsCmd.AddCommand(worldRowsEditCmd)
+	worldRowsCmd.AddCommand(worldRowsMvCmd)
+	worldRowsCmd.AddCommand(worldRowsRmCmd)
+	worldRowsCmd.AddCommand(worldStaffPicksCmd)
+
+	rootCmd.AddCommand(worldRowsCmd)
+}
+
+var worldRowsCmd = &cobra.Command{
+	Use:   "worldrows",
+	Short: "manage the dynamic world rows shown in the client's world menu",
+}
+
+var worldRowsLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "lists all rows, in order",
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		worldRowsLs()
+	},
+}
+
+var worldRowsAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "adds a row after the existing ones",
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		var row config.ApiDynamicWorldRow
+		applyWorldRowFlags(cmd.Flags(), &row)
+		created, err := models.AddDynamicWorldRow(row, operator())
+		if err != nil {
+			log.Fatalf("failed to add row: %v", err)
+		}
+		log.Printf("Row %s has been added at index %d\n", created.Name, created.Index)
+	},
+}
+
+var worldRowsEditCmd = &cobra.Command{
+	Use:   "edit <index>",
+	Short: "changes the fields of a row that are passed as flags",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		index := parseRowIndex(args[0])
+		if _, err := models.UpdateDynamicWorldRow(index, operator(), func(row *config.ApiDynamicWorldRow) {
+			applyWorldRowFlags(cmd.Flags(), row)
+		}); err != nil {
+			log.Fatalf("failed to update row: %v", err)
+		}
+		log.Printf("Row %d has been updated\n", index)
+	},
+}
+
+var worldRowsMvCmd = &cobra.Command{
+	Use:   "mv <index> <new index>",
+	Short: "moves a row to another index",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		if err := models.MoveDynamicWorldRow(parseRowIndex(args[0]), parseRowIndex(args[1]), operator()); err != nil {
+			log.Fatalf("failed to move row: %v", err)
+		}
+		worldRowsLs()
+	},
+}
+
+var worldRowsRmCmd = &cobra.Command{
+	Use:   "rm <index>",
+	Short: "removes a row",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		if err := models.RemoveDynamicWorldRow(parseRowIndex(args[0]), operator()); err != nil {
+			log.Fatalf("failed to remove row: %v", err)
+		}
+		worldRowsLs()
+	},
+}
+
+var worldStaffPicksCmd = &cobra.Command{
+	Use:   "staffpicks",
+	Short: "manage the curated worlds shown by rows sorted by staffpicks",
+}
+
+var worldStaffPicksLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "lists the staff picked worlds, in order",
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		worldStaffPicksLs()
+	},
+}
+
+var worldStaffPicksAddCmd = &cobra.Command{
+	Use:   "add <world id>",
+	Short: "adds a world to the staff picks (or moves it if it already is one)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		initializeDB()
+		position, _ := cmd.Flags().GetInt("position")
+		if err := models.AddWorldStaffPick(args[0], position, operator()); err != nil {
+			log.Fatalf("failed to add staff pick: %v", err)
+		}
+		worldStaffPicksLs()
+	},
+}
+
+var worldStaffPicksRmCmd = &cobra.Command{
+	Use:   "rm <world id>",
+	Short: "removes a world from the staff picks",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeRedis()
+		if err := models.RemoveWorldStaffPick(args[0], operator()); err != nil {
+			log.Fatalf("failed to remove staff pick: %v", err)
+		}
+		worldStaffPicksLs()
+	},
+}
+
+func worldRowsLs() {
+	rows, err := models.GetDynamicWorldRows()
+	if err != nil {
+		log.Fatalf("failed to list rows: %v", err)
+	}
+
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Index", "Name", "Sort", "Order", "Ownership", "Platform", "Tag"})
+	for _, row := range rows {
+		tb.AppendRow(table.Row{row.Index, row.Name, row.SortHeading, row.SortOrder, row.SortOwnership, row.Platform, row.Tag})
+	}
+	tb.Render()
+}
+
+func worldStaffPicksLs() {
+	ids, err := models.GetWorldStaffPicks()
+	if err != nil {
+		log.Fatalf("failed to list staff picks: %v", err)
+	}
+
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Position", "World Id"})
+	for i, id := range ids {
+		tb.AppendRow(table.Row{i, id})
+	}
+	tb.Render()
+}
+
+// parseRowIndex parses the index of a row passed as an argument.
+func parseRowIndex(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalf("invalid row index: %s", s)
+	}
+
+	return i
+}
+
+// applyWorldRowFlags copies the flags that were passed onto the row.
+func applyWorldRowFlags(f *pflag.FlagSet, row *config.ApiDynamicWorldRow) {
+	if f.Changed("name") {
+		row.Name, _ = f.GetString("name")
+	}
+	if f.Changed("sort") {
+		row.SortHeading, _ = f.GetString("sort")
+	}
+	if f.Changed("order") {
+		row.SortOrder, _ = f.GetString("order")
+	}
+	if f.Changed("ownership") {
+		row.SortOwnership, _ = f.GetString("ownership")
+	}
+	if f.Changed("platform") {
+		row.Platform, _ = f.GetString("platform")
+	}
+	if f.Changed("tag") {
+		row.Tag, _ = f.GetString("tag")
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	hsync "github.com/gtsatsis/harvester/sync"
 	"gorm.io/gorm"
 	"sync"
+	"time"
 )
 
 var ApiConfiguration = ApiConfig{}
@@ -32,6 +34,22 @@ type ApiConfig struct {
 	FilesS3AccessKey hsync.String `json:"-" seed:"" redis:"{config}:filesS3AccessKey"`
 	FilesS3SecretKey hsync.Secret `json:"-" seed:"" redis:"{config}:filesS3SecretKey"`
 	FilesS3Bucket    hsync.String `json:"-" seed:"" redis:"{config}:filesS3Bucket"`
+	// Files download urls
+	FilesUrlExpirySeconds   hsync.Int64  `json:"-" seed:"300" redis:"{config}:filesUrlExpirySeconds"`   // FilesUrlExpirySeconds is how long presigned download urls stay valid.
+	FilesUrlCacheTtlSeconds hsync.Int64  `json:"-" seed:"240" redis:"{config}:filesUrlCacheTtlSeconds"` // FilesUrlCacheTtlSeconds is how long presigned download urls are cached for (always less than their lifetime). 0 disables caching.
+	FilesPublicBaseUrl      hsync.String `json:"-" seed:"" redis:"{config}:filesPublicBaseUrl"`         // FilesPublicBaseUrl is the (CDN) url objects are publicly served from. When set, public content is not presigned.
+	// Files storage limits (0 disables a limit)
+	FilesUserQuotaBytes     hsync.Int64 `json:"-" seed:"10737418240" redis:"{config}:filesUserQuotaBytes"`   // FilesUserQuotaBytes is the total size of the files each user may store.
+	FilesUserMaxFiles       hsync.Int64 `json:"-" seed:"1000" redis:"{config}:filesUserMaxFiles"`            // FilesUserMaxFiles is the amount of files each user may create.
+	FilesMaxWorldSizeBytes  hsync.Int64 `json:"-" seed:"1073741824" redis:"{config}:filesMaxWorldSizeBytes"` // FilesMaxWorldSizeBytes is the maximum size of a single world (.vrcw) upload.
+	FilesMaxAvatarSizeBytes hsync.Int64 `json:"-" seed:"524288000" redis:"{config}:filesMaxAvatarSizeBytes"` // FilesMaxAvatarSizeBytes is the maximum size of a single avatar (.vrca) upload.
+	FilesMaxImageSizeBytes  hsync.Int64 `json:"-" seed:"10485760" redis:"{config}:filesMaxImageSizeBytes"`   // FilesMaxImageSizeBytes is the maximum size of a single image upload.
+	// World rows
+	WorldStaffPicks WorldIdList `json:"-" seed:"[]" redis:"{config}:worldStaffPicks"` // WorldStaffPicks is the curated, ordered list of worlds returned for the "staffpicks" sort.
+	// Client compatibility
+	MinimumClientBuild hsync.Int64          `json:"-" seed:"0" redis:"{config}:minimumClientBuild"` // MinimumClientBuild is the oldest client build that is accepted. 0 disables the check.
+	MaximumClientBuild hsync.Int64          `json:"-" seed:"0" redis:"{config}:maximumClientBuild"` // MaximumClientBuild is the newest client build that is accepted. 0 disables the check.
+	ClientProfiles     ApiClientProfileList `json:"-" seed:"[]" redis:"{config}:clientProfiles"`    // ClientProfiles adjust the responses sent to ranges of client builds.
 	// Photon Room Settings
 	PhotonSettingMaxAccountsPerIpAddress hsync.Int64 `seed:"5" json:"maxAccountsPerIp" redis:"{config}:photonSettingMaxAccountsPerIp"`
 	// Connector Mod AutoConfig Functionality
@@ -236,9 +254,34 @@ type ApiDynamicWorldRow struct {
 	Index         int    `json:"index"`         // Index is the index of the row.
 	Name          string `json:"name"`          // Name is the name of the row.
 	Platform      string `json:"platform"`      // Platform is the platform of the row.
-	SortHeading   string `json:"sortHeading"`   // SortHeading ???
-	SortOrder     string `json:"sortOrder"`     // SortOrder ???
-	SortOwnership string `json:"sortOwnership"` // SortOwnership ???
+	SortHeading   string `json:"sortHeading"`   // SortHeading is what the row is sorted by; the client requests /worlds?sort=<SortHeading>.
+	SortOrder     string `json:"sortOrder"`     // SortOrder is the order of the row (ascending/descending); the client requests /worlds?order=<SortOrder>.
+	SortOwnership string `json:"sortOwnership"` // SortOwnership is whose worlds are shown (any/mine); "mine" makes the client request /worlds?user=me.
+	Tag           string `json:"tag,omitempty"` // Tag limits the row to worlds with the tag; the client requests /worlds?tag=<Tag>.
+}
+
+type WorldIdList struct {
+	m    sync.RWMutex
+	List []string
+}
+
+func (w *WorldIdList) SetString(s string) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return json.Unmarshal([]byte(s), &w.List)
+}
+
+func (w *WorldIdList) Get() []string {
+	w.m.RLock()
+	defer w.m.RUnlock()
+	return w.List
+}
+
+func (w *WorldIdList) String() string {
+	w.m.RLock()
+	defer w.m.RUnlock()
+	b, _ := json.Marshal(w)
+	return string(b)
 }
 
 type ApiEvents struct {
@@ -378,6 +421,124 @@ type ApiInfoPush struct {
 	Hash          string                 `json:"hash"`
 	CreatedAt     string                 `json:"createdAt"`
 	UpdatedAt     string                 `json:"updatedAt"`
+	StartDate     string                 `json:"startDate,omitempty"` // StartDate is when the push starts being shown (RFC3339). The push is shown immediately if this is empty.
+	EndDate       string                 `json:"endDate,omitempty"`   // EndDate is when the push stops being shown (RFC3339). The push is shown indefinitely if this is empty.
+}
+
+// IsActive returns whether the push is enabled & its start/end window contains t. Unparsable dates are ignored.
+func (p *ApiInfoPush) IsActive(t time.Time) bool {
+	if !p.IsEnabled {
+		return false
+	}
+
+	if start, err := time.Parse(time.RFC3339, p.StartDate); err == nil && t.Before(start) {
+		return false
+	}
+
+	if end, err := time.Parse(time.RFC3339, p.EndDate); err == nil && !t.Before(end) {
+		return false
+	}
+
+	return true
+}
+
+// ApiClientPayload is a kind of response payload that can be transformed by an ApiClientProfile.
+type ApiClientPayload string
+
+const (
+	ApiClientPayloadConfig ApiClientPayload = "config" // ApiClientPayloadConfig is the response of /config.
+	ApiClientPayloadUser   ApiClientPayload = "user"   // ApiClientPayloadUser is the current user, as returned by /auth/user.
+	ApiClientPayloadWorld  ApiClientPayload = "world"  // ApiClientPayloadWorld is a world, as returned by /worlds.
+	ApiClientPayloadAvatar ApiClientPayload = "avatar" // ApiClientPayloadAvatar is an avatar, as returned by /avatars.
+)
+
+type ApiClientProfileList struct {
+	m    sync.RWMutex
+	List []ApiClientProfile
+}
+
+// SetString parses & validates the profiles; invalid profiles are rejected as a whole.
+func (w *ApiClientProfileList) SetString(s string) error {
+	var profiles []ApiClientProfile
+	if err := json.Unmarshal([]byte(s), &profiles); err != nil {
+		return err
+	}
+
+	for i := range profiles {
+		if err := profiles[i].Validate(); err != nil {
+			return fmt.Errorf("profile %d (%s): %w", i, profiles[i].Name, err)
+		}
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.List = profiles
+	return nil
+}
+
+func (w *ApiClientProfileList) Get() []ApiClientProfile {
+	w.m.RLock()
+	defer w.m.RUnlock()
+	return w.List
+}
+
+func (w *ApiClientProfileList) String() string {
+	w.m.RLock()
+	defer w.m.RUnlock()
+	b, _ := json.Marshal(w)
+	return string(b)
+}
+
+// ApiClientProfile adjusts the responses sent to a range of client builds, which are identified by their X-Client-Version
+// header. All profiles matching a build are applied, in order.
+type ApiClientProfile struct {
+	Name            string                                         `json:"name"`                      // Name identifies the profile.
+	MinBuild        int64                                          `json:"minBuild"`                  // MinBuild is the oldest build the profile applies to. 0 leaves it unbounded.
+	MaxBuild        int64                                          `json:"maxBuild"`                  // MaxBuild is the newest build the profile applies to. 0 leaves it unbounded.
+	ConfigOverrides map[string]json.RawMessage                     `json:"configOverrides,omitempty"` // ConfigOverrides replaces fields of ApiConfigResponse, keyed by their JSON name (e.g.: "sdkUnityVersion").
+	Transforms      map[ApiClientPayload]ApiClientPayloadTransform `json:"transforms,omitempty"`      // Transforms are applied to the payloads of the kind they are keyed by.
+}
+
+// ApiClientPayloadTransform changes the top-level fields of a payload. Renames are applied first, then omissions, then
+// the values that are set.
+type ApiClientPayloadTransform struct {
+	Rename map[string]string          `json:"rename,omitempty"` // Rename renames fields, keyed by their current name. Renames are applied in the order of those names.
+	Omit   []string                   `json:"omit,omitempty"`   // Omit removes fields.
+	Set    map[string]json.RawMessage `json:"set,omitempty"`    // Set sets fields, adding them if they are missing.
+}
+
+// Matches returns whether the profile applies to the build. Unknown (0) builds match no profile.
+func (p *ApiClientProfile) Matches(build int64) bool {
+	return build > 0 && (p.MinBuild == 0 || build >= p.MinBuild) && (p.MaxBuild == 0 || build <= p.MaxBuild)
+}
+
+// Validate checks the build range, that the payloads are known, and that the config overrides are fields of
+// ApiConfigResponse with values of their type.
+func (p *ApiClientProfile) Validate() error {
+	if p.MinBuild < 0 || p.MaxBuild < 0 || (p.MaxBuild != 0 && p.MaxBuild < p.MinBuild) {
+		return fmt.Errorf("invalid build range %d-%d", p.MinBuild, p.MaxBuild)
+	}
+
+	for payload := range p.Transforms {
+		switch payload {
+		case ApiClientPayloadConfig, ApiClientPayloadUser, ApiClientPayloadWorld, ApiClientPayloadAvatar:
+		default:
+			return fmt.Errorf("unknown payload %q", payload)
+		}
+	}
+
+	if len(p.ConfigOverrides) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(p.ConfigOverrides)
+	if err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	return d.Decode(&ApiConfigResponse{})
 }
 
 // ApiConfigResponse is the response from the /config endpoint. It contains public values from ApiConfig with native types.
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoConfigHistory        = errors.New("config key has no recorded changes")
+	ErrConfigVersionNotFound  = errors.New("config version not found")
+	ErrConfigAlreadyAtVersion = errors.New("config value is already at that version")
+)
+
+// apiConfigHistoryLength is the number of changes kept in the history of each field; older ones are dropped.
+const apiConfigHistoryLength = 100
+
+// ApiConfigHistoryEntry is a recorded change of a configuration value.
+type ApiConfigHistoryEntry struct {
+	Key        string    `json:"key"`                  // Key is the name of the field that was changed.
+	Version    int64     `json:"version"`              // Version is incremented by every change of the field, starting at 1.
+	Who        string    `json:"who"`                  // Who is the admin (or CLI operator) that made the change.
+	At         time.Time `json:"at"`                   // At is when the change was made.
+	Old        string    `json:"old"`                  // Old is the value before the change (the seed if it was not set).
+	New        string    `json:"new"`                  // New is the value after the change.
+	RollbackOf *int64    `json:"rollbackOf,omitempty"` // RollbackOf is the version that was restored if the change was a rollback (0 being the value before the first recorded change).
+}
+
+// HistoryKey returns the key the history of the field is stored under. It shares the {config} hash tag of the value, so
+// both can be updated in the same transaction.
+func (f *ApiConfigField) HistoryKey() string {
+	return "{config}:history:" + strings.TrimPrefix(f.RedisKey, "{config}:")
+}
+
+// GetApiConfigHistory returns the recorded changes of the field, oldest first.
+func GetApiConfigHistory(ctx context.Context, f *ApiConfigField) ([]ApiConfigHistoryEntry, error) {
+	s, err := HarvestRedisClient.LRange(ctx, f.HistoryKey(), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries = make([]ApiConfigHistoryEntry, len(s))
+	for i := range s {
+		if err = json.Unmarshal([]byte(s[i]), &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// UpdateApiConfigValues atomically replaces the values of the fields with the ones returned by fn, which receives their
+// current values keyed by field name. Values that differ from the current ones are validated, stored, and recorded in
+// the history of their field as changed by who. It is retried if any of the fields is changed concurrently.
+func UpdateApiConfigValues(ctx context.Context, who string, fields []*ApiConfigField, fn func(current map[string]string) (map[string]string, error)) error {
+	_, err := updateApiConfigValues(ctx, who, fields, func(current map[string]string) (map[string]ApiConfigHistoryEntry, error) {
+		values, err := fn(current)
+		if err != nil {
+			return nil, err
+		}
+
+		var changes = make(map[string]ApiConfigHistoryEntry, len(values))
+		for name, value := range values {
+			changes[name] = ApiConfigHistoryEntry{New: value}
+		}
+
+		return changes, nil
+	})
+	return err
+}
+
+// RollbackApiConfigValue restores the value the field had as of the version, or the value it had before its latest
+// change if version is 0 or less. The rollback is recorded as a change of its own, which is returned.
+func RollbackApiConfigValue(ctx context.Context, f *ApiConfigField, version int64, who string) (*ApiConfigHistoryEntry, error) {
+	entries, err := updateApiConfigValues(ctx, who, []*ApiConfigField{f}, func(current map[string]string) (map[string]ApiConfigHistoryEntry, error) {
+		// The history is watched along with the value, so reading it here is consistent with the current value.
+		history, err := GetApiConfigHistory(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(history) == 0 {
+			return nil, ErrNoConfigHistory
+		}
+
+		var restored ApiConfigHistoryEntry
+		if version <= 0 {
+			latest := history[len(history)-1]
+			previous := latest.Version - 1
+			restored = ApiConfigHistoryEntry{New: latest.Old, RollbackOf: &previous}
+		} else {
+			found := false
+			for _, e := range history {
+				if e.Version == version {
+					restored, found = ApiConfigHistoryEntry{New: e.New, RollbackOf: &version}, true
+					break
+				}
+			}
+
+			if !found {
+				return nil, ErrConfigVersionNotFound
+			}
+		}
+
+		if restored.New == current[f.Name] {
+			return nil, ErrConfigAlreadyAtVersion
+		}
+
+		return map[string]ApiConfigHistoryEntry{f.Name: restored}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entries[0], nil
+}
+
+// updateApiConfigValues is UpdateApiConfigValues with fn returning the changes as history entries, of which only New &
+// RollbackOf have to be set. The recorded entries are returned.
+func updateApiConfigValues(ctx context.Context, who string, fields []*ApiConfigField, fn func(current map[string]string) (map[string]ApiConfigHistoryEntry, error)) ([]ApiConfigHistoryEntry, error) {
+	var keys []string
+	for _, f := range fields {
+		keys = append(keys, f.RedisKey, f.HistoryKey())
+	}
+
+	var recorded []ApiConfigHistoryEntry
+	txf := func(tx *redis.Tx) error {
+		recorded = nil
+
+		var current = make(map[string]string, len(fields))
+		for _, f := range fields {
+			v, _, err := getApiConfigValue(ctx, tx, f)
+			if err != nil {
+				return err
+			}
+
+			current[f.Name] = v
+		}
+
+		changes, err := fn(current)
+		if err != nil {
+			return err
+		}
+
+		var changed []*ApiConfigField
+		for _, f := range fields {
+			e, ok := changes[f.Name]
+			if !ok || e.New == current[f.Name] {
+				continue
+			}
+
+			if err = f.Validate(e.New); err != nil {
+				return err
+			}
+
+			latest, err := latestApiConfigVersion(ctx, tx, f)
+			if err != nil {
+				return err
+			}
+
+			e.Key, e.Version, e.Who, e.At, e.Old = f.Name, latest+1, who, time.Now().UTC(), current[f.Name]
+			changed = append(changed, f)
+			recorded = append(recorded, e)
+		}
+
+		if len(recorded) == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, f := range changed {
+				b, err := json.Marshal(recorded[i])
+				if err != nil {
+					return err
+				}
+
+				pipe.Set(ctx, f.RedisKey, recorded[i].New, 0)
+				pipe.RPush(ctx, f.HistoryKey(), string(b))
+				pipe.LTrim(ctx, f.HistoryKey(), -apiConfigHistoryLength, -1)
+			}
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = HarvestRedisClient.Watch(ctx, txf, keys...); err != redis.TxFailedErr {
+			break
+		}
+	}
+
+	return recorded, err
+}
+
+// latestApiConfigVersion returns the version of the latest recorded change of the field, or 0 if there is none.
+func latestApiConfigVersion(ctx context.Context, c redis.Cmdable, f *ApiConfigField) (int64, error) {
+	s, err := c.LIndex(ctx, f.HistoryKey(), -1).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var e ApiConfigHistoryEntry
+	if err = json.Unmarshal([]byte(s), &e); err != nil {
+		return 0, err
+	}
+
+	return e.Version, nil
+}
@@ -0,0 +1,367 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/ghodss/yaml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	configEnvPrefix = "SHOYA_"
+	configJsonEnv   = "SHOYA_CONFIG_JSON"
+	configFileEnv   = "_FILE" // configFileEnv is the suffix of the variables holding the path of a file to read a value from.
+)
+
+type configFormat string
+
+const (
+	configFormatJson configFormat = "json"
+	configFormatYaml configFormat = "yaml"
+	configFormatToml configFormat = "toml"
+)
+
+// readConfigFile reads the config file at the path into a tree of keys, in the format matching its extension.
+func readConfigFile(p string) (map[string]interface{}, error) {
+	var format configFormat
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".json":
+		format = configFormatJson
+	case ".yaml", ".yml":
+		format = configFormatYaml
+	case ".toml":
+		format = configFormatToml
+	default:
+		return nil, fmt.Errorf("unsupported format %q (expected .json, .yaml, .yml or .toml)", filepath.Ext(p))
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeConfig(format, b)
+}
+
+// decodeConfig decodes a config into a tree of keys. YAML & TOML are converted to the same tree JSON decodes to, so
+// every format is validated & decoded the same way.
+func decodeConfig(format configFormat, b []byte) (map[string]interface{}, error) {
+	var err error
+	switch format {
+	case configFormatYaml:
+		if b, err = yaml.YAMLToJSON(b); err != nil {
+			return nil, err
+		}
+	case configFormatToml:
+		var t map[string]interface{}
+		if _, err = toml.Decode(string(b), &t); err != nil {
+			return nil, err
+		}
+		if b, err = json.Marshal(t); err != nil {
+			return nil, err
+		}
+	}
+
+	var t map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&t); err != nil {
+		return nil, err
+	}
+
+	if t == nil {
+		t = map[string]interface{}{} // An empty YAML document decodes to null.
+	}
+
+	return t, nil
+}
+
+// mergeConfigTrees merges src into dst. Keys holding objects in both are merged recursively; src wins otherwise.
+func mergeConfigTrees(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sv, ok := v.(map[string]interface{})
+		dv, ok2 := dst[k].(map[string]interface{})
+		if ok && ok2 {
+			mergeConfigTrees(dv, sv)
+			continue
+		}
+
+		dst[k] = v
+	}
+}
+
+// configField is a field of SvcConfig that can be set by an environment variable.
+type configField struct {
+	path []string
+	kind reflect.Kind
+}
+
+// configFields returns the fields of the struct type (& its nested structs) that hold a value, keyed by their json name.
+func configFields(t reflect.Type) map[string]reflect.StructField {
+	var fields = map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && name == "" {
+			for k, v := range configFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+
+		fields[name] = f
+	}
+
+	return fields
+}
+
+// leafConfigFields returns every field of the struct type that holds a scalar value, along with its path.
+func leafConfigFields(t reflect.Type, prefix []string) []configField {
+	var leaves []configField
+	for name, f := range configFields(t) {
+		p := append(append([]string{}, prefix...), name)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if ft.Kind() == reflect.Struct {
+			leaves = append(leaves, leafConfigFields(ft, p)...)
+			continue
+		}
+
+		leaves = append(leaves, configField{path: p, kind: ft.Kind()})
+	}
+
+	return leaves
+}
+
+// configEnvName returns the name of the environment variable overriding the field at the path, e.g.: api.postgres.db is
+// overridden by SHOYA_API_POSTGRES_DB, and discovery.discoveryApiKey by SHOYA_DISCOVERY_DISCOVERY_API_KEY.
+func configEnvName(path []string) string {
+	var b strings.Builder
+	b.WriteString(configEnvPrefix)
+	for i, p := range path {
+		if i != 0 {
+			b.WriteByte('_')
+		}
+
+		for j, r := range p {
+			if unicode.IsUpper(r) && j != 0 && p[j-1] != '_' {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+
+	return b.String()
+}
+
+// applyConfigEnv sets the fields of the tree that have an environment variable set, and returns how many there were.
+func applyConfigEnv(tree map[string]interface{}) (int, error) {
+	var n int
+	var problems []string
+	for _, f := range leafConfigFields(reflect.TypeOf(SvcConfig{}), nil) {
+		name := configEnvName(f.path)
+		value, ok := os.LookupEnv(name)
+
+		if p, fromFile := os.LookupEnv(name + configFileEnv); fromFile {
+			if ok {
+				problems = append(problems, fmt.Sprintf("only one of %s & %s may be set", name, name+configFileEnv))
+				continue
+			}
+
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name+configFileEnv, err))
+				continue
+			}
+
+			name, value, ok = name+configFileEnv, strings.TrimRight(string(b), "\r\n"), true
+		}
+
+		if !ok {
+			continue
+		}
+
+		var v interface{}
+		switch f.kind {
+		case reflect.String:
+			v = value
+		case reflect.Int, reflect.Int64:
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not an integer", name, value))
+				continue
+			}
+			v = json.Number(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a boolean", name, value))
+				continue
+			}
+			v = b
+		default:
+			problems = append(problems, fmt.Sprintf("%s: fields of kind %s can't be set from the environment", name, f.kind))
+			continue
+		}
+
+		setConfigValue(tree, f.path, v)
+		n++
+	}
+
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return n, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return n, nil
+}
+
+// setConfigValue sets the value at the path of the tree, creating (or replacing) the objects leading to it.
+func setConfigValue(tree map[string]interface{}, path []string, v interface{}) {
+	for _, p := range path[:len(path)-1] {
+		next, ok := tree[p].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			tree[p] = next
+		}
+		tree = next
+	}
+
+	tree[path[len(path)-1]] = v
+}
+
+// buildConfig checks that every key of the tree matches a field, and decodes it.
+func buildConfig(tree map[string]interface{}) (*SvcConfig, error) {
+	if problems := unknownConfigKeys(tree, reflect.TypeOf(SvcConfig{}), ""); len(problems) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	b, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var c SvcConfig
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// unknownConfigKeys returns a problem for every key of the tree that doesn't match a field of the struct type.
+func unknownConfigKeys(tree map[string]interface{}, t reflect.Type, prefix string) []string {
+	var problems []string
+	fields := configFields(t)
+
+	var keys []string
+	for k := range tree {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f, ok := fields[k]
+		if !ok {
+			problem := fmt.Sprintf("unknown key %s%s", prefix, k)
+			if s := suggestConfigKey(k, fields); s != "" {
+				problem += fmt.Sprintf(" (did you mean %s%s?)", prefix, s)
+			}
+
+			problems = append(problems, problem)
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// Values of the wrong type (e.g.: a string for a section) are reported when the tree is decoded.
+		if sub, ok := tree[k].(map[string]interface{}); ok && ft.Kind() == reflect.Struct {
+			problems = append(problems, unknownConfigKeys(sub, ft, prefix+k+".")...)
+		}
+	}
+
+	return problems
+}
+
+// suggestConfigKey returns the field the key most likely meant, ignoring case & underscores (e.g.: listenAddress for
+// listen_address), or an empty string if there is none.
+func suggestConfigKey(key string, fields map[string]reflect.StructField) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	}
+
+	for name := range fields {
+		if normalize(name) == normalize(key) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// missingConfigValues returns the paths (keys of values) whose value is empty, sorted.
+func missingConfigValues(values map[string]string) []string {
+	var missing []string
+	for k, v := range values {
+		if v == "" {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+func (c *WebSvcConfig) missing() []string {
+	return missingConfigValues(map[string]string{
+		"fiber.listen_address": c.Fiber.ListenAddress,
+		"redis.host":           c.Redis.Host,
+	})
+}
+
+func (c *ApiSvcConfig) missing() []string {
+	return append(c.WebSvcConfig.missing(), missingConfigValues(map[string]string{
+		"postgres.host": c.Postgres.Host,
+		"postgres.db":   c.Postgres.Database,
+	})...)
+}
+
+func (c *WsSvcConfig) missing() []string {
+	return c.WebSvcConfig.missing()
+}
+
+func (c *DiscoverySvcConfig) missing() []string {
+	return append(c.WebSvcConfig.missing(), missingConfigValues(map[string]string{
+		"discoveryApiKey": c.DiscoveryApiKey,
+	})...)
+}
+
+func (c *FilesSvcConfig) missing() []string {
+	return missingConfigValues(map[string]string{
+		"listen_address": c.ListenAddress,
+		"redis.host":     c.Redis.Host,
+		"postgres.host":  c.Postgres.Host,
+		"postgres.db":    c.Postgres.Database,
+	})
+}
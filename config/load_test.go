@@ -0,0 +1,232 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigEnvName(t *testing.T) {
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"api", "fiber", "listen_address"}, "SHOYA_API_FIBER_LISTEN_ADDRESS"},
+		{[]string{"api", "postgres", "db"}, "SHOYA_API_POSTGRES_DB"},
+		{[]string{"api", "apiConfigRefreshRateMs"}, "SHOYA_API_API_CONFIG_REFRESH_RATE_MS"},
+		{[]string{"discovery", "discoveryApiKey"}, "SHOYA_DISCOVERY_DISCOVERY_API_KEY"},
+		{[]string{"files", "tls", "clientCaFile"}, "SHOYA_FILES_TLS_CLIENT_CA_FILE"},
+	}
+
+	for _, tt := range tests {
+		if got := configEnvName(tt.path); got != tt.want {
+			t.Errorf("configEnvName(%v) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestApplyConfigEnv(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "string",
+			env:  map[string]string{"SHOYA_API_FIBER_LISTEN_ADDRESS": ":8080"},
+			want: map[string]interface{}{"api": map[string]interface{}{"fiber": map[string]interface{}{"listen_address": ":8080"}}},
+		},
+		{
+			name: "integer & boolean",
+			env:  map[string]string{"SHOYA_WS_REDIS_DB": "2", "SHOYA_WS_FIBER_PREFORK": "true"},
+			want: map[string]interface{}{"ws": map[string]interface{}{
+				"redis": map[string]interface{}{"db": json.Number("2")},
+				"fiber": map[string]interface{}{"prefork": true},
+			}},
+		},
+		{
+			name: "file",
+			env:  map[string]string{"SHOYA_API_POSTGRES_PASSWORD_FILE": secret},
+			want: map[string]interface{}{"api": map[string]interface{}{"postgres": map[string]interface{}{"password": "hunter2"}}},
+		},
+		{
+			name:    "value & file",
+			env:     map[string]string{"SHOYA_API_POSTGRES_PASSWORD": "hunter2", "SHOYA_API_POSTGRES_PASSWORD_FILE": secret},
+			wantErr: "only one of SHOYA_API_POSTGRES_PASSWORD & SHOYA_API_POSTGRES_PASSWORD_FILE may be set",
+		},
+		{
+			name:    "missing file",
+			env:     map[string]string{"SHOYA_API_POSTGRES_PASSWORD_FILE": secret + ".missing"},
+			wantErr: "SHOYA_API_POSTGRES_PASSWORD_FILE: ",
+		},
+		{
+			name:    "invalid integer",
+			env:     map[string]string{"SHOYA_API_POSTGRES_PORT": "five"},
+			wantErr: `SHOYA_API_POSTGRES_PORT: "five" is not an integer`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			tree := map[string]interface{}{}
+			n, err := applyConfigEnv(tree)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyConfigEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("applyConfigEnv() error = %v", err)
+			}
+			if n != len(tt.env) {
+				t.Errorf("applyConfigEnv() = %d, want %d", n, len(tt.env))
+			}
+			if !reflect.DeepEqual(tree, tt.want) {
+				t.Errorf("applyConfigEnv() tree = %v, want %v", tree, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:   "known keys",
+			config: `{"api": {"fiber": {"listen_address": ":8080"}, "files": {"tls": {"enabled": true}}}}`,
+		},
+		{
+			name:    "unknown section",
+			config:  `{"analytics": {}}`,
+			wantErr: "unknown key analytics",
+		},
+		{
+			name:    "misspelled key",
+			config:  `{"api": {"fiber": {"listenAddress": ":8080"}}}`,
+			wantErr: "unknown key api.fiber.listenAddress (did you mean api.fiber.listen_address?)",
+		},
+		{
+			name:    "key of an embedded struct",
+			config:  `{"files": {"fiber": {}}}`,
+			wantErr: "unknown key files.fiber",
+		},
+		{
+			name:    "wrong type",
+			config:  `{"api": {"postgres": {"port": "5432"}}}`,
+			wantErr: "cannot unmarshal string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := decodeConfig(configFormatJson, []byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = buildConfig(tree)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("buildConfig() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("buildConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json":   `{"discovery": {"discoveryApiKey": "key", "instanceTtlSeconds": 60, "fiber": {"listen_address": ":8082", "prefork": true}}}`,
+		"config.yaml":   "discovery:\n  discoveryApiKey: key\n  instanceTtlSeconds: 60\n  fiber:\n    listen_address: \":8082\"\n    prefork: true\n",
+		"config.toml":   "[discovery]\ndiscoveryApiKey = \"key\"\ninstanceTtlSeconds = 60\n\n[discovery.fiber]\nlisten_address = \":8082\"\nprefork = true\n",
+		"override.toml": "[discovery]\ninstanceTtlSeconds = 120\n",
+		"unknown.yaml":  "discovery:\n  instanceTtl: 60\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := func(ttl int) SvcConfig {
+		return SvcConfig{Discovery: &DiscoverySvcConfig{
+			WebSvcConfig:       WebSvcConfig{Fiber: FiberSvcConfig{ListenAddress: ":8082", Prefork: true}},
+			DiscoveryApiKey:    "key",
+			InstanceTtlSeconds: ttl,
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		files   []string
+		env     map[string]string
+		want    SvcConfig
+		wantErr error
+	}{
+		{name: "json", files: []string{"config.json"}, want: want(60)},
+		{name: "yaml", files: []string{"config.yaml"}, want: want(60)},
+		{name: "toml", files: []string{"config.toml"}, want: want(60)},
+		{name: "later files override", files: []string{"config.yaml", "override.toml"}, want: want(120)},
+		{
+			name:  "environment overrides files",
+			files: []string{"config.toml"},
+			env:   map[string]string{"SHOYA_DISCOVERY_INSTANCE_TTL_SECONDS": "300"},
+			want:  want(300),
+		},
+		{name: "unknown key", files: []string{"unknown.yaml"}, wantErr: ErrInvalidConfig},
+	}
+
+	previous := RuntimeConfig
+	t.Cleanup(func() { RuntimeConfig = previous })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(configJsonEnv, "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var paths []string
+			for _, f := range tt.files {
+				paths = append(paths, filepath.Join(dir, f))
+			}
+
+			RuntimeConfig = SvcConfig{}
+			err := LoadConfig(paths...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(RuntimeConfig, tt.want) {
+				t.Errorf("LoadConfig() = %+v, want %+v", RuntimeConfig.Discovery, tt.want.Discovery)
+			}
+		})
+	}
+}
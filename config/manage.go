@@ -0,0 +1,198 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownConfigKey = errors.New("unknown config key")
+
+// ApiConfigField describes a field of ApiConfig that is stored in Redis.
+type ApiConfigField struct {
+	Name     string // Name is the name of the field in ApiConfig (e.g.: InfoPushes).
+	RedisKey string // RedisKey is the key the value is stored under (e.g.: {config}:infoPushes).
+	Seed     string // Seed is the default value of the field.
+	Type     string // Type is the name of the type of the field (e.g.: Int64, ApiInfoPushesList).
+	Secret   bool   // Secret is whether the value should be hidden when it is displayed.
+
+	typ reflect.Type
+}
+
+// ApiConfigFields returns all fields of ApiConfig that are stored in Redis, in the order they are declared in.
+func ApiConfigFields() []*ApiConfigField {
+	var fields []*ApiConfigField
+	t := reflect.TypeOf((*ApiConfig)(nil)).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, ok := sf.Tag.Lookup("redis")
+		if !ok {
+			continue
+		}
+
+		fields = append(fields, &ApiConfigField{
+			Name:     sf.Name,
+			RedisKey: key,
+			Seed:     sf.Tag.Get("seed"),
+			Type:     sf.Type.Name(),
+			Secret:   sf.Type.Name() == "Secret",
+			typ:      sf.Type,
+		})
+	}
+
+	return fields
+}
+
+// LookupApiConfigField returns the field with the name. The name of the field in ApiConfig (InfoPushes), its Redis key
+// ({config}:infoPushes), or the Redis key without its prefix (infoPushes) are accepted, case-insensitively.
+func LookupApiConfigField(name string) (*ApiConfigField, error) {
+	for _, f := range ApiConfigFields() {
+		if strings.EqualFold(f.Name, name) || strings.EqualFold(f.RedisKey, name) || strings.EqualFold(strings.TrimPrefix(f.RedisKey, "{config}:"), name) {
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownConfigKey, name)
+}
+
+// Validate checks that the value can be parsed by the field, using the SetString method of its type.
+func (f *ApiConfigField) Validate(value string) error {
+	v := reflect.New(f.typ)
+	setter, ok := v.Interface().(interface{ SetString(string) error })
+	if !ok {
+		return fmt.Errorf("%s (%s) cannot be set from a string", f.Name, f.Type)
+	}
+
+	if err := setter.SetString(value); err != nil {
+		return fmt.Errorf("invalid value for %s (%s): %w", f.Name, f.Type, err)
+	}
+
+	return nil
+}
+
+// Apply sets the value on ApiConfiguration right away, rather than waiting for the harvester to pick it up.
+func (f *ApiConfigField) Apply(value string) error {
+	setter, ok := reflect.ValueOf(&ApiConfiguration).Elem().FieldByName(f.Name).Addr().Interface().(interface{ SetString(string) error })
+	if !ok {
+		return fmt.Errorf("%s (%s) cannot be set from a string", f.Name, f.Type)
+	}
+
+	return setter.SetString(value)
+}
+
+// Display returns the value as it should be displayed, hiding it if the field is a secret.
+func (f *ApiConfigField) Display(value string) string {
+	if f.Secret && value != "" {
+		return "***"
+	}
+
+	return value
+}
+
+// GetApiConfigValue returns the value of the field as stored in Redis, or its seed if it has not been set.
+func GetApiConfigValue(ctx context.Context, f *ApiConfigField) (value string, isSet bool, err error) {
+	return getApiConfigValue(ctx, HarvestRedisClient, f)
+}
+
+// getApiConfigValue is GetApiConfigValue using the client c, e.g.: a transaction watching the field.
+func getApiConfigValue(ctx context.Context, c redis.Cmdable, f *ApiConfigField) (value string, isSet bool, err error) {
+	value, err = c.Get(ctx, f.RedisKey).Result()
+	if err == redis.Nil {
+		return f.Seed, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// GetApiConfigValues returns the values of all fields, keyed by their name.
+func GetApiConfigValues(ctx context.Context) (map[string]string, error) {
+	values := map[string]string{}
+	for _, f := range ApiConfigFields() {
+		v, _, err := GetApiConfigValue(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+
+		values[f.Name] = v
+	}
+
+	return values, nil
+}
+
+// SetApiConfigValue validates the value & stores it, recording the change as made by who. Running services pick it up
+// through the harvester.
+func SetApiConfigValue(ctx context.Context, f *ApiConfigField, value, who string) error {
+	if err := f.Validate(value); err != nil {
+		return err
+	}
+
+	return UpdateApiConfigValues(ctx, who, []*ApiConfigField{f}, func(map[string]string) (map[string]string, error) {
+		return map[string]string{f.Name: value}, nil
+	})
+}
+
+// SetApiConfigValues validates all values before storing any of them, keyed by the name of their field. The changes are
+// recorded as made by who.
+func SetApiConfigValues(ctx context.Context, values map[string]string, who string) error {
+	var fields []*ApiConfigField
+	var byName = map[string]string{}
+	for name, value := range values {
+		f, err := LookupApiConfigField(name)
+		if err != nil {
+			return err
+		}
+
+		if err = f.Validate(value); err != nil {
+			return err
+		}
+
+		fields = append(fields, f)
+		byName[f.Name] = value
+	}
+
+	return UpdateApiConfigValues(ctx, who, fields, func(map[string]string) (map[string]string, error) {
+		return byName, nil
+	})
+}
+
+// ApiConfigChange is a difference between two sets of ApiConfig values.
+type ApiConfigChange struct {
+	Field *ApiConfigField
+	Old   string
+	New   string
+}
+
+// DiffApiConfigValues returns the fields whose values differ between old & new, ordered by their name. Fields missing
+// from either set are ignored.
+func DiffApiConfigValues(old, new map[string]string) []ApiConfigChange {
+	var changes []ApiConfigChange
+	for _, f := range ApiConfigFields() {
+		o, ok := old[f.Name]
+		n, ok2 := new[f.Name]
+		if ok && ok2 && o != n {
+			changes = append(changes, ApiConfigChange{Field: f, Old: o, New: n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field.Name < changes[j].Field.Name
+	})
+	return changes
+}
+
+// ApiConfigSeeds returns the seed values of all fields, keyed by their name.
+func ApiConfigSeeds() map[string]string {
+	seeds := map[string]string{}
+	for _, f := range ApiConfigFields() {
+		seeds[f.Name] = f.Seed
+	}
+
+	return seeds
+}
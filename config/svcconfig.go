@@ -1,63 +1,125 @@
 package config
 
 import (
-	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"os"
 	"path"
+	"strings"
 )
 
 var RuntimeConfig SvcConfig
 
-func LoadConfig(config ...string) error {
-	var configPath string
-	var configInEnv string
-	var err error
+var (
+	ErrNoConfig      = errors.New("no config found")
+	ErrInvalidConfig = errors.New("invalid config")
+)
 
-	if len(config) == 0 || config[0] == "config.json" {
-		var ok bool
-		if configInEnv, ok = os.LookupEnv("SHOYA_CONFIG_JSON"); !ok {
-			configPath = "./config.json"
-		}
+// DefaultConfigPaths are the files loaded when no path is given; unlike given paths, they are skipped if they don't exist.
+var DefaultConfigPaths = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// LoadConfig loads RuntimeConfig from the following sources, each of them overriding the ones before it:
+//  1. The files at the paths, in order. Their format (JSON, YAML or TOML) is chosen by their extension.
+//  2. The SHOYA_CONFIG_JSON environment variable, holding an entire config as JSON.
+//  3. An environment variable per field, named after its path (e.g.: SHOYA_API_POSTGRES_PASSWORD for api.postgres.password).
+//     Suffixing it with _FILE reads the value from the file at the path it holds instead (e.g.: a Docker secret).
+//
+// Keys that don't match a field are rejected; whether the sections of a service are complete is checked by Require.
+func LoadConfig(paths ...string) error {
+	var optional bool
+	if len(paths) == 0 {
+		paths, optional = DefaultConfigPaths, true
 	}
 
-	if configPath == "" && configInEnv == "" {
-		for _, p := range config {
-			p = path.Clean(p)
-			if _, err := os.Stat(p); !os.IsNotExist(err) {
-				configPath = p
-				break
+	var tree = map[string]interface{}{}
+	var sources []string
+	for _, p := range paths {
+		p = path.Clean(p)
+		if _, err := os.Stat(p); err != nil {
+			if optional && os.IsNotExist(err) {
+				continue
 			}
+			return err
 		}
 
-		if configPath == "" {
-			return errors.New("no config found")
+		t, err := readConfigFile(p)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, p, err)
 		}
+
+		mergeConfigTrees(tree, t)
+		sources = append(sources, p)
 	}
 
-	if configInEnv != "" {
-		err = json.Unmarshal([]byte(configInEnv), &RuntimeConfig)
+	if blob, ok := os.LookupEnv(configJsonEnv); ok && blob != "" {
+		t, err := decodeConfig(configFormatJson, []byte(blob))
 		if err != nil {
-			return err
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, configJsonEnv, err)
 		}
 
-		return nil
+		mergeConfigTrees(tree, t)
+		sources = append(sources, configJsonEnv)
 	}
 
-	if configPath != "" {
-		var f []byte
-		f, err = ioutil.ReadFile(configPath)
-		if err != nil {
-			return err
+	overrides, err := applyConfigEnv(tree)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	if len(sources) == 0 && overrides == 0 {
+		return fmt.Errorf("%w (looked for %s, %s & %s* variables)", ErrNoConfig, strings.Join(paths, ", "), configJsonEnv, configEnvPrefix)
+	}
+
+	c, err := buildConfig(tree)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	RuntimeConfig = *c
+	return nil
+}
+
+// Require checks that the sections are present, and hold the values their services can't run without.
+func (c *SvcConfig) Require(sections ...string) error {
+	var problems []string
+	for _, s := range sections {
+		var missing []string
+		switch s {
+		case "api":
+			if c.Api == nil {
+				problems = append(problems, "section api is missing")
+				continue
+			}
+			missing = c.Api.missing()
+		case "ws":
+			if c.Ws == nil {
+				problems = append(problems, "section ws is missing")
+				continue
+			}
+			missing = c.Ws.missing()
+		case "discovery":
+			if c.Discovery == nil {
+				problems = append(problems, "section discovery is missing")
+				continue
+			}
+			missing = c.Discovery.missing()
+		case "files":
+			if c.Files == nil {
+				problems = append(problems, "section files is missing")
+				continue
+			}
+			missing = c.Files.missing()
+		default:
+			return fmt.Errorf("unknown config section %s", s)
 		}
 
-		err = json.Unmarshal(f, &RuntimeConfig)
-		if err != nil {
-			return err
+		for _, m := range missing {
+			problems = append(problems, fmt.Sprintf("%s.%s is required (or %s)", s, m, configEnvName(strings.Split(s+"."+m, "."))))
 		}
+	}
 
-		return nil
+	if len(problems) != 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
 	}
 
 	return nil
@@ -74,7 +136,8 @@ type SvcConfig struct {
 // ApiSvcConfig is the configuration struct used by the `api` service.
 type ApiSvcConfig struct {
 	WebSvcConfig
-	ApiConfigRefreshRateMs int `json:"apiConfigRefreshRateMs"` // The refresh rate of the dynamic configuration for the API.
+	ApiConfigRefreshRateMs int                 `json:"apiConfigRefreshRateMs"` // The refresh rate of the dynamic configuration for the API.
+	Files                  GrpcClientSvcConfig `json:"files"`                  // How the API connects to the `files` service.
 }
 
 // WsSvcConfig is the configuration struct used by the `ws` service.
@@ -85,12 +148,30 @@ type WsSvcConfig struct {
 // DiscoverySvcConfig is the configuration struct used by the `discovery` service.
 type DiscoverySvcConfig struct {
 	WebSvcConfig
-	DiscoveryApiKey string `json:"discoveryApiKey"` // The API key that is authorized to contact the Discovery service.
+	DiscoveryApiKey        string `json:"discoveryApiKey"`        // The API key that is authorized to contact the Discovery service.
+	InstanceTtlSeconds     int    `json:"instanceTtlSeconds"`     // The amount of seconds an instance may go without a ping before it is considered stale. Defaults to 3600.
+	CleanupIntervalSeconds int    `json:"cleanupIntervalSeconds"` // The interval (in seconds) at which the cleanup routine sweeps for stale instances. Defaults to 30.
+	CleanupBatchSize       int    `json:"cleanupBatchSize"`       // The maximum amount of instances fetched per search during a cleanup sweep. Defaults to 100.
+	InstanceCacheTtlMs     int    `json:"instanceCacheTtlMs"`     // The maximum time (in milliseconds) instances are kept in the client-side cache. 0 disables the cache.
 }
 
 type FilesSvcConfig struct {
 	GrpcSvcConfig
-	Redis RedisSvcConfig `json:"redis"`
+	Redis                   RedisSvcConfig        `json:"redis"`
+	Postgres                PostgresSvcConfig     `json:"postgres"`
+	Storage                 FilesStorageSvcConfig `json:"storage"`
+	GcIntervalMinutes       int                   `json:"gcIntervalMinutes"`       // How often orphaned files are garbage collected while the service runs. 0 disables periodic collection.
+	GcGracePeriodMinutes    int                   `json:"gcGracePeriodMinutes"`    // How old objects, uploads & versions have to be before they are collected. Defaults to 1440 (24h).
+	HealthCheckCacheSeconds int                   `json:"healthCheckCacheSeconds"` // How long (in seconds) the result of a health check, which writes to storage, is reused for. Defaults to 30.
+}
+
+// FilesStorageSvcConfig is the configuration struct used to select & configure the storage backend of the `files` service.
+type FilesStorageSvcConfig struct {
+	Backend            string `json:"backend"`            // The storage backend to use, either s3 (the default) or local.
+	LocalPath          string `json:"localPath"`          // The directory objects are stored in when using the local backend.
+	LocalListenAddress string `json:"localListenAddress"` // The address the local backend serves (signed) upload & download urls on.
+	LocalBaseUrl       string `json:"localBaseUrl"`       // The publicly reachable url of LocalListenAddress, used when building signed urls.
+	LocalSigningKey    string `json:"localSigningKey"`    // The secret used to sign the urls of the local backend.
 }
 
 type WebSvcConfig struct {
@@ -120,5 +201,29 @@ type PostgresSvcConfig struct {
 }
 
 type GrpcSvcConfig struct {
-	ListenAddress string `json:"listen_address"`
+	ListenAddress string           `json:"listen_address"`
+	Tls           GrpcTlsSvcConfig `json:"tls"`
+	AuthToken     string           `json:"authToken"` // The token callers have to present. Token authentication is disabled if this is empty.
+}
+
+// GrpcTlsSvcConfig is the configuration struct used to serve a gRPC service over TLS.
+type GrpcTlsSvcConfig struct {
+	CertFile     string `json:"certFile"`     // The certificate the service presents. TLS is disabled if this is empty.
+	KeyFile      string `json:"keyFile"`      // The private key of CertFile.
+	ClientCaFile string `json:"clientCaFile"` // The CA that client certificates have to be signed by. If set, clients have to present a certificate (mTLS).
+}
+
+// GrpcClientSvcConfig is the configuration struct used to connect to a gRPC service.
+type GrpcClientSvcConfig struct {
+	Tls       GrpcClientTlsSvcConfig `json:"tls"`
+	AuthToken string                 `json:"authToken"` // The token presented to the service, which has to match its AuthToken.
+}
+
+// GrpcClientTlsSvcConfig is the configuration struct used to connect to a gRPC service over TLS.
+type GrpcClientTlsSvcConfig struct {
+	Enabled    bool   `json:"enabled"`    // Whether to connect over TLS.
+	CaFile     string `json:"caFile"`     // The CA the certificate of the service has to be signed by. The system roots are used if this is empty.
+	CertFile   string `json:"certFile"`   // The client certificate presented to the service (mTLS).
+	KeyFile    string `json:"keyFile"`    // The private key of CertFile.
+	ServerName string `json:"serverName"` // Overrides the name the certificate of the service is verified against.
 }
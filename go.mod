@@ -3,7 +3,9 @@ module gitlab.com/george/shoya-go
 go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.2.0
 	github.com/alexedwards/argon2id v0.0.0-20211130144151-3585854a6387
+	github.com/ghodss/yaml v1.0.0
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/gofiber/fiber/v2 v2.33.0
 	github.com/gofiber/websocket/v2 v2.0.21
@@ -15,6 +17,7 @@ require (
 	github.com/minio/minio-go/v7 v7.0.27
 	github.com/rueian/rueidis v0.0.45
 	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
 	github.com/tj/go-naturaldate v1.3.0
 	github.com/tkanos/gonfig v0.0.0-20210106201359-53e13348de2f
 	google.golang.org/grpc v1.47.0
@@ -31,7 +34,6 @@ require (
 	github.com/dustin/go-humanize v1.0.0 // indirect
 	github.com/fasthttp/websocket v1.5.0 // indirect
 	github.com/fatih/color v1.13.0 // indirect
-	github.com/ghodss/yaml v1.0.0 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/gopherjs/gopherjs v1.17.2 // indirect
 	github.com/hashicorp/consul/api v1.12.0 // indirect
@@ -69,7 +71,6 @@ require (
 	github.com/savsgio/gotils v0.0.0-20220401102855-e56b59f40436 // indirect
 	github.com/sirupsen/logrus v1.8.1 // indirect
 	github.com/smartystreets/assertions v1.13.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.36.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
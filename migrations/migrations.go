@@ -0,0 +1,253 @@
+// Package migrations manages the versioned schema of the database. Applied migrations are recorded in the
+// schema_migrations table; `shoya db migrate` applies & reverts them, and the services refuse to start until every
+// migration they know of has been applied.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+var ErrPendingMigrations = errors.New("database schema is not up to date")
+
+// lockKey is the key of the advisory lock held while a migration is applied or reverted, so replicas & operators
+// migrating at the same time do not apply a migration twice.
+const lockKey = 0x73686f7961
+
+// Migration is a reversible change of the schema. Its statements are executed in a single transaction, in order.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// SchemaMigration is a row of the schema_migrations table, recording an applied migration.
+type SchemaMigration struct {
+	Version   int64
+	Name      string
+	AppliedAt int64
+}
+
+// Status is the state of a migration in the database. Migrations applied by a newer build of Shoya are Unknown.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt int64
+	Unknown   bool
+}
+
+// Latest returns the version of the newest migration.
+func Latest() int64 {
+	return migrations[len(migrations)-1].Version
+}
+
+// Statuses returns the state of every known migration, along with the applied migrations that are unknown to this build,
+// ordered by version.
+func Statuses(db *gorm.DB) ([]Status, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return statusesOf(migrations, applied), nil
+}
+
+// statusesOf returns the state of every known migration given the applied ones, ordered by version.
+func statusesOf(known []Migration, applied map[int64]SchemaMigration) []Status {
+	var unknown = make(map[int64]SchemaMigration, len(applied))
+	for v, a := range applied {
+		unknown[v] = a
+	}
+
+	var statuses []Status
+	for _, m := range known {
+		s := Status{Version: m.Version, Name: m.Name}
+		if a, ok := unknown[m.Version]; ok {
+			s.Applied, s.AppliedAt = true, a.AppliedAt
+			delete(unknown, m.Version)
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	for _, a := range unknown {
+		statuses = append(statuses, Status{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, Unknown: true})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses
+}
+
+// Check returns ErrPendingMigrations if any known migration has not been applied. Migrations applied by a newer build
+// are ignored, so replicas that have not been upgraded yet keep working during a rolling upgrade.
+func Check(db *gorm.DB) error {
+	statuses, err := Statuses(db)
+	if err != nil {
+		return err
+	}
+
+	var pending []int64
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Version)
+		}
+	}
+
+	if len(pending) != 0 {
+		return fmt.Errorf("%w: %d pending migration(s) %v", ErrPendingMigrations, len(pending), pending)
+	}
+
+	return nil
+}
+
+// Up applies the pending migrations up to & including the version (or all of them if it is 0), in order. The applied
+// migrations are returned.
+func Up(db *gorm.DB, to int64) ([]Migration, error) {
+	statuses, err := Statuses(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range pendingMigrations(statuses, to) {
+		if err = apply(db, m, true); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// Down reverts the given amount of the most recently applied migrations, newest first. The reverted migrations are
+// returned. Migrations applied by a newer build cannot be reverted, and have to be reverted by that build.
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	statuses, err := Statuses(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// The migrations newer than one applied by a newer build are still reverted; the error is returned after them.
+	revert, planErr := revertedMigrations(statuses, steps)
+
+	var done []Migration
+	for _, m := range revert {
+		if err = apply(db, m, false); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+
+		done = append(done, m)
+	}
+
+	return done, planErr
+}
+
+// pendingMigrations returns the migrations Up applies, oldest first.
+func pendingMigrations(statuses []Status, to int64) []Migration {
+	var pending []Migration
+	for _, s := range statuses {
+		if s.Applied || (to != 0 && s.Version > to) {
+			continue
+		}
+
+		pending = append(pending, migration(s.Version))
+	}
+
+	return pending
+}
+
+// revertedMigrations returns the migrations Down reverts, newest first. If it reaches a migration applied by a newer
+// build, the migrations before it are returned along with an error.
+func revertedMigrations(statuses []Status, steps int) ([]Migration, error) {
+	var revert []Migration
+	for i := len(statuses) - 1; i >= 0 && len(revert) < steps; i-- {
+		s := statuses[i]
+		if !s.Applied {
+			continue
+		}
+
+		if s.Unknown {
+			return revert, fmt.Errorf("migration %d (%s) was applied by a newer build and has to be reverted by it", s.Version, s.Name)
+		}
+
+		revert = append(revert, migration(s.Version))
+	}
+
+	return revert, nil
+}
+
+// migration returns the known migration with the version.
+func migration(version int64) Migration {
+	for _, m := range migrations {
+		if m.Version == version {
+			return m
+		}
+	}
+
+	panic(fmt.Sprintf("unknown migration %d", version))
+}
+
+// apply applies (or reverts) the migration in a transaction, recording it in schema_migrations. Nothing is done if
+// another replica or operator applied (or reverted) it in the meantime.
+func apply(db *gorm.DB, m Migration, up bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockKey).Error; err != nil {
+			return err
+		}
+
+		var n int64
+		if err := tx.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&n).Error; err != nil {
+			return err
+		}
+
+		if (n != 0) == up {
+			return nil
+		}
+
+		statements := m.Up
+		if !up {
+			statements = m.Down
+		}
+
+		for _, s := range statements {
+			if err := tx.Exec(s).Error; err != nil {
+				return err
+			}
+		}
+
+		if !up {
+			return tx.Where("version = ?", m.Version).Delete(&SchemaMigration{}).Error
+		}
+
+		return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC().Unix()}).Error
+	})
+}
+
+// appliedMigrations returns the applied migrations keyed by their version, creating schema_migrations if it does not
+// exist yet.
+func appliedMigrations(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS "schema_migrations" ("version" bigint, "name" text NOT NULL, "applied_at" bigint NOT NULL, PRIMARY KEY ("version"))`).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []SchemaMigration
+	if err = db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var applied = make(map[int64]SchemaMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,91 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d (%s) has version %d, want %d", i, m.Name, m.Version, i+1)
+		}
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			t.Errorf("migration %d (%s) is not reversible", m.Version, m.Name)
+		}
+	}
+}
+
+// appliedUpTo returns the applied migrations for the versions.
+func appliedUpTo(versions ...int64) map[int64]SchemaMigration {
+	var applied = map[int64]SchemaMigration{}
+	for _, v := range versions {
+		applied[v] = SchemaMigration{Version: v, Name: "applied", AppliedAt: v}
+	}
+
+	return applied
+}
+
+// versionsOf returns the versions of the migrations, in order.
+func versionsOf(ms []Migration) []int64 {
+	var versions []int64
+	for _, m := range ms {
+		versions = append(versions, m.Version)
+	}
+
+	return versions
+}
+
+func TestPendingMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied map[int64]SchemaMigration
+		to      int64
+		want    []int64
+	}{
+		{name: "fresh database", applied: appliedUpTo(), want: []int64{1, 2, 3, 4}},
+		{name: "up to a version", applied: appliedUpTo(), to: 2, want: []int64{1, 2}},
+		{name: "partially applied", applied: appliedUpTo(1, 2), want: []int64{3, 4}},
+		{name: "gap", applied: appliedUpTo(1, 3), want: []int64{2, 4}},
+		{name: "up to date", applied: appliedUpTo(1, 2, 3, 4), want: nil},
+		{name: "newer build", applied: appliedUpTo(1, 2, 3, 4, 5), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := versionsOf(pendingMigrations(statusesOf(migrations, tt.applied), tt.to))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pendingMigrations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevertedMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied map[int64]SchemaMigration
+		steps   int
+		want    []int64
+		wantErr bool
+	}{
+		{name: "one step", applied: appliedUpTo(1, 2, 3, 4), steps: 1, want: []int64{4}},
+		{name: "newest first", applied: appliedUpTo(1, 2, 3, 4), steps: 3, want: []int64{4, 3, 2}},
+		{name: "more steps than applied", applied: appliedUpTo(1, 2), steps: 5, want: []int64{2, 1}},
+		{name: "gap", applied: appliedUpTo(1, 3), steps: 2, want: []int64{3, 1}},
+		{name: "nothing applied", applied: appliedUpTo(), steps: 1, want: nil},
+		{name: "newer build", applied: appliedUpTo(1, 2, 3, 4, 5), steps: 1, want: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := revertedMigrations(statusesOf(migrations, tt.applied), tt.steps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("revertedMigrations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(versionsOf(got), tt.want) {
+				t.Errorf("revertedMigrations() = %v, want %v", versionsOf(got), tt.want)
+			}
+		})
+	}
+}
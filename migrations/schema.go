@@ -0,0 +1,295 @@
+package migrations
+
+// migrations are all known migrations, ordered by version. Applied migrations must never be changed; changes to the
+// schema are made by adding a new migration.
+//
+// The baseline matches the schema created by AutoMigrate before migrations were introduced, and only creates what does
+// not exist yet, so existing databases can adopt it. The migrations after it may already have been applied by
+// AutoMigrate as well, and are idempotent for the same reason.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS "files" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"owner_id" text,
+				"name" text,
+				"mime_type" text,
+				"extension" text,
+				PRIMARY KEY ("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_files_deleted_at" ON "files" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "avatars" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"author_id" text,
+				"name" text,
+				"description" text,
+				"image_id" text,
+				"release_status" text,
+				"tags" text[] NOT NULL DEFAULT '{}'::text[],
+				"version" bigint NOT NULL DEFAULT 0,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_avatars_image" FOREIGN KEY ("image_id") REFERENCES "files"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_avatars_deleted_at" ON "avatars" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "worlds" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"author_id" text,
+				"name" text,
+				"description" text,
+				"capacity" bigint,
+				"image_id" text,
+				"release_status" text DEFAULT 'private',
+				"tags" text[] NOT NULL DEFAULT '{}'::text[],
+				"version" bigint NOT NULL DEFAULT 0,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_worlds_image" FOREIGN KEY ("image_id") REFERENCES "files"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_worlds_deleted_at" ON "worlds" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "users" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"accepted_terms_of_service_version" bigint,
+				"allow_avatar_copying" boolean,
+				"bio" text,
+				"bio_links" text[] NOT NULL DEFAULT '{}'::text[],
+				"username" text,
+				"display_name" text,
+				"developer_type" text DEFAULT 'none',
+				"email" text,
+				"pending_email" text,
+				"email_verified" boolean,
+				"password" text,
+				"current_avatar_id" text,
+				"fallback_avatar_id" text,
+				"home_world_id" text,
+				"status" text,
+				"status_description" text,
+				"tags" text[] NOT NULL DEFAULT '{}'::text[],
+				"last_login" bigint,
+				"last_platform" text,
+				"mfa_enabled" boolean,
+				"mfa_secret" text,
+				"mfa_recovery_codes" text[] NOT NULL DEFAULT '{}'::text[],
+				"friend_key" text,
+				"profile_pic_override" text,
+				"unsubscribe" boolean,
+				"user_icon" text,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_users_current_avatar" FOREIGN KEY ("current_avatar_id") REFERENCES "avatars"("id"),
+				CONSTRAINT "fk_users_fallback_avatar" FOREIGN KEY ("fallback_avatar_id") REFERENCES "avatars"("id"),
+				CONSTRAINT "fk_users_home_world" FOREIGN KEY ("home_world_id") REFERENCES "worlds"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "favorite_groups" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"user_id" text,
+				"group_type" text,
+				"name" text,
+				"max_items" bigint,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_users_user_favorites" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+				CONSTRAINT "fk_users_world_favorites" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+				CONSTRAINT "fk_users_avatar_favorites" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_favorite_groups_deleted_at" ON "favorite_groups" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "favorite_items" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"favorite_group_id" text,
+				"owner_id" text,
+				"item_id" text,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_favorite_groups_items" FOREIGN KEY ("favorite_group_id") REFERENCES "favorite_groups"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_favorite_items_deleted_at" ON "favorite_items" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "moderations" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"source_id" text,
+				"target_id" text,
+				"world_id" text,
+				"instance_id" text,
+				"type" text,
+				"reason" text,
+				"expires_at" bigint,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_users_moderations" FOREIGN KEY ("target_id") REFERENCES "users"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_moderations_deleted_at" ON "moderations" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "permissions" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"user_id" text,
+				"name" text,
+				"created_by" text,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_users_permissions" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_permissions_deleted_at" ON "permissions" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "world_unity_packages" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"belongs_to_asset_id" text,
+				"file_id" text,
+				"file_version" bigint,
+				"version" bigint,
+				"platform" text,
+				"unity_version" text,
+				"unity_sort_number" bigint,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_worlds_unity_packages" FOREIGN KEY ("belongs_to_asset_id") REFERENCES "worlds"("id"),
+				CONSTRAINT "fk_world_unity_packages_file" FOREIGN KEY ("file_id") REFERENCES "files"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_world_unity_packages_deleted_at" ON "world_unity_packages" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "avatar_unity_packages" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"belongs_to_asset_id" text,
+				"file_id" text,
+				"file_version" bigint,
+				"version" bigint,
+				"platform" text,
+				"unity_version" text,
+				"unity_sort_number" bigint,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_avatars_unity_packages" FOREIGN KEY ("belongs_to_asset_id") REFERENCES "avatars"("id"),
+				CONSTRAINT "fk_avatar_unity_packages_file" FOREIGN KEY ("file_id") REFERENCES "files"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_avatar_unity_packages_deleted_at" ON "avatar_unity_packages" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "player_moderations" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"source_id" text,
+				"target_id" text,
+				"action" text,
+				PRIMARY KEY ("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_player_moderations_deleted_at" ON "player_moderations" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "file_descriptors" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"file_id" text,
+				"type" text,
+				"status" text,
+				"category" text,
+				"size_in_bytes" bigint,
+				"file_name" text,
+				"url" text,
+				"md5" text,
+				"upload_id" text,
+				PRIMARY KEY ("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_file_descriptors_deleted_at" ON "file_descriptors" ("deleted_at")`,
+			`CREATE TABLE IF NOT EXISTS "file_versions" (
+				"id" text,
+				"created_at" bigint,
+				"updated_at" bigint,
+				"deleted_at" timestamptz,
+				"file_id" text,
+				"version" bigint,
+				"status" text,
+				"file_descriptor_id" text,
+				"delta_descriptor_id" text,
+				"signature_descriptor_id" text,
+				PRIMARY KEY ("id"),
+				CONSTRAINT "fk_file_versions_delta_descriptor" FOREIGN KEY ("delta_descriptor_id") REFERENCES "file_descriptors"("id"),
+				CONSTRAINT "fk_file_versions_signature_descriptor" FOREIGN KEY ("signature_descriptor_id") REFERENCES "file_descriptors"("id"),
+				CONSTRAINT "fk_files_versions" FOREIGN KEY ("file_id") REFERENCES "files"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+				CONSTRAINT "fk_file_versions_file_descriptor" FOREIGN KEY ("file_descriptor_id") REFERENCES "file_descriptors"("id")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_file_versions_deleted_at" ON "file_versions" ("deleted_at")`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS "file_versions"`,
+			`DROP TABLE IF EXISTS "file_descriptors"`,
+			`DROP TABLE IF EXISTS "player_moderations"`,
+			`DROP TABLE IF EXISTS "avatar_unity_packages"`,
+			`DROP TABLE IF EXISTS "world_unity_packages"`,
+			`DROP TABLE IF EXISTS "permissions"`,
+			`DROP TABLE IF EXISTS "moderations"`,
+			`DROP TABLE IF EXISTS "favorite_items"`,
+			`DROP TABLE IF EXISTS "favorite_groups"`,
+			`DROP TABLE IF EXISTS "users"`,
+			`DROP TABLE IF EXISTS "worlds"`,
+			`DROP TABLE IF EXISTS "avatars"`,
+			`DROP TABLE IF EXISTS "files"`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "file_descriptors_upload_state",
+		Up: []string{
+			`ALTER TABLE "file_descriptors" ADD COLUMN IF NOT EXISTS "part_e_tags" text[] NOT NULL DEFAULT '{}'::text[]`,
+			`ALTER TABLE "file_descriptors" ADD COLUMN IF NOT EXISTS "error_reason" text`,
+		},
+		Down: []string{
+			`ALTER TABLE "file_descriptors" DROP COLUMN IF EXISTS "error_reason"`,
+			`ALTER TABLE "file_descriptors" DROP COLUMN IF EXISTS "part_e_tags"`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "users_storage_overrides",
+		Up: []string{
+			`ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "storage_quota_bytes_override" bigint`,
+			`ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "storage_max_files_override" bigint`,
+		},
+		Down: []string{
+			`ALTER TABLE "users" DROP COLUMN IF EXISTS "storage_max_files_override"`,
+			`ALTER TABLE "users" DROP COLUMN IF EXISTS "storage_quota_bytes_override"`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "file_objects",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS "file_objects" (
+				"name" text,
+				"md5" text,
+				"sha256" text,
+				"size_in_bytes" bigint,
+				"reference_count" bigint,
+				"created_at" bigint,
+				"updated_at" bigint,
+				PRIMARY KEY ("name")
+			)`,
+			`CREATE INDEX IF NOT EXISTS "idx_file_objects_md5" ON "file_objects" ("md5")`,
+			`CREATE INDEX IF NOT EXISTS "idx_file_objects_sha256" ON "file_objects" ("sha256")`,
+			`ALTER TABLE "file_descriptors" ADD COLUMN IF NOT EXISTS "object_name" text`,
+		},
+		Down: []string{
+			`ALTER TABLE "file_descriptors" DROP COLUMN IF EXISTS "object_name"`,
+			`DROP TABLE IF EXISTS "file_objects"`,
+		},
+	},
+}
@@ -91,7 +91,7 @@ func (a *Avatar) GetImageUrl() string {
 }
 
 func (a *Avatar) GetThumbnailImageUrl() string {
-	return a.Image.GetLatestVersion().GetFileUrl()
+	return a.Image.GetLatestVersion().GetImageUrl(ImageThumbnailWidth)
 }
 
 func (a *Avatar) GetAPIAvatar() (*APIAvatar, error) {
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"gitlab.com/george/shoya-go/config"
+	"reflect"
+)
+
+// modifyConfigValue atomically updates a JSON configuration value stored in Redis: the stored value is unmarshalled into
+// v, fn modifies it, and v is written back. The change is recorded in the config history as made by who. It is retried
+// if the value is changed concurrently, and the written JSON is returned.
+func modifyConfigValue(key, who string, v interface{}, fn func() error) (string, error) {
+	f, err := config.LookupApiConfigField(key)
+	if err != nil {
+		return "", err
+	}
+
+	var s string
+	err = config.UpdateApiConfigValues(context.Background(), who, []*config.ApiConfigField{f}, func(current map[string]string) (map[string]string, error) {
+		// Retries start from a clean slate rather than the result of the failed attempt.
+		rv := reflect.ValueOf(v).Elem()
+		rv.Set(reflect.Zero(rv.Type()))
+
+		if current[f.Name] != "" {
+			if err := json.Unmarshal([]byte(current[f.Name]), v); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := fn(); err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		s = string(b)
+		return map[string]string{f.Name: s}, nil
+	})
+
+	return s, err
+}
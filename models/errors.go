@@ -103,4 +103,28 @@ var (
 	ErrInvalidAuthCookie                             = errors.New("invalid auth cookie")
 	ErrFileNotFound                                  = errors.New("file version not found")
 	ErrUrlParseFailed                                = errors.New("url parse failed")
+	ErrInstanceMissingNonce                          = errors.New("this instance is missing a nonce")
+	ErrInstanceInvalidNonce                          = errors.New("this instance has an invalid nonce")
+	ErrInstanceNotFriendsWithOwner                   = errors.New("you must be friends with the owner of this instance to join it")
+	ErrInstanceNoFriendsInInstance                   = errors.New("you must be friends with someone in this instance to join it")
+	ErrInstanceNotInvited                            = errors.New("you must be invited to join this instance")
+	ErrInvalidInstanceType                           = errors.New("invalid instance type")
+	ErrInvalidInstanceRegion                         = errors.New("invalid instance region")
+	ErrInstanceShortNameNotFound                     = errors.New("instance short name not found")
+	ErrStorageQuotaExceeded                          = errors.New("this upload would exceed your storage quota")
+	ErrStorageFileLimitReached                       = errors.New("you have reached the maximum amount of files")
+	ErrFileTooLarge                                  = errors.New("file exceeds the maximum upload size for its type")
+	ErrInfoPushNotFound                              = errors.New("infopush not found")
+	ErrInvalidInfoPushDate                           = errors.New("infopush dates must be in RFC3339 format")
+	ErrInfoPushEndsBeforeStart                       = errors.New("infopush end date must be after its start date")
+	ErrWorldRowNotFound                              = errors.New("world row not found")
+	ErrInvalidWorldRowName                           = errors.New("world row name must not be empty")
+	ErrInvalidWorldSort                              = errors.New("invalid world sort")
+	ErrInvalidWorldSortOrder                         = errors.New("world sort order must be ascending or descending")
+	ErrInvalidWorldSortOwnership                     = errors.New("world sort ownership must be any or mine")
+	ErrWorldNotStaffPicked                           = errors.New("world is not a staff pick")
+	ErrModerationInThePast                           = errors.New("cannot create moderation in the past")
+	ErrPermissionAlreadyGranted                      = errors.New("user already has the permission")
+	ErrPermissionNotGranted                          = errors.New("user does not have the permission")
+	ErrInvalidDeveloperType                          = errors.New("invalid developer type")
 )
@@ -1,16 +1,33 @@
 package models
 
 import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gitlab.com/george/shoya-go/config"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"strings"
 	"time"
 )
 
 var FileAllowedExtensions = []string{".vrca", ".vrcw", ".png", ".jpg", ".jpeg"}
 
+// FileMultipartUploadThreshold is the size (in bytes) above which descriptors are uploaded in multiple parts.
+const FileMultipartUploadThreshold = 100 * 1024 * 1024
+
+// FileMaxUploadParts is the maximum amount of parts a multipart upload can consist of (as imposed by S3).
+const FileMaxUploadParts = 10000
+
+// ImageVariantWidths are the widths that resized variants of images are generated in.
+var ImageVariantWidths = []int{256, 512, 1024}
+
+// ImageThumbnailWidth is the width of the image variant used for thumbnails.
+const ImageThumbnailWidth = 256
+
 type FileDescriptorType string
 
 const (
@@ -96,6 +113,20 @@ func GetFile(id string) (*File, error) {
 	return f, nil
 }
 
+// publicFileIds is a subquery returning the ids of all files that are used by a public avatar or world.
+const publicFileIds = `SELECT w.image_id AS file_id FROM worlds w WHERE w.release_status = 'public' AND w.deleted_at IS NULL
+UNION SELECT a.image_id FROM avatars a WHERE a.release_status = 'public' AND a.deleted_at IS NULL
+UNION SELECT p.file_id FROM world_unity_packages p JOIN worlds w ON w.id = p.belongs_to_asset_id WHERE w.release_status = 'public' AND w.deleted_at IS NULL
+UNION SELECT p.file_id FROM avatar_unity_packages p JOIN avatars a ON a.id = p.belongs_to_asset_id WHERE a.release_status = 'public' AND a.deleted_at IS NULL`
+
+// IsPublic returns whether the file is used by a public avatar or world, and may therefore be served to anyone.
+func (f *File) IsPublic() (bool, error) {
+	var public bool
+	err := config.DB.Raw("SELECT EXISTS (SELECT 1 FROM ("+publicFileIds+") p WHERE p.file_id = ?)", f.ID).Scan(&public).Error
+
+	return public, err
+}
+
 func (f *File) GetVersion(ver int) *FileVersion {
 	for _, fv := range f.Versions {
 		if fv.Version == ver {
@@ -146,6 +177,23 @@ func (f *FileVersion) GetSignatureUrl() string {
 	return fmt.Sprintf("%s/file/%s/%d/%s", config.ApiConfiguration.ApiUrl.Get(), f.FileID, f.Version, FileDescriptorTypeSignature)
 }
 
+// GetImageUrl returns the url of the variant of the (image) file resized to the provided width.
+func (f *FileVersion) GetImageUrl(width int) string {
+	return fmt.Sprintf("%s/image/%s/%d/%d", config.ApiConfiguration.ApiUrl.Get(), f.FileID, f.Version, width)
+}
+
+// ImageVariantWidth returns the smallest width that image variants are generated in which is at least as wide as the
+// requested width, or the largest one if there is none.
+func ImageVariantWidth(requested int) int {
+	for _, w := range ImageVariantWidths {
+		if w >= requested {
+			return w
+		}
+	}
+
+	return ImageVariantWidths[len(ImageVariantWidths)-1]
+}
+
 func (f *FileVersion) BeforeCreate(*gorm.DB) (err error) {
 	f.ID = "filever_" + uuid.New().String()
 	return
@@ -161,7 +209,44 @@ type FileDescriptor struct {
 	FileName    string             `json:"fileName"`
 	Url         string             `json:"url"`
 	Md5         string             `json:"md5"`
-	UploadId    string             `json:"uploadId"` // ?
+	UploadId    string             `json:"uploadId"`                                            // The id of the S3 multipart upload, if Category is multipart.
+	PartETags   pq.StringArray     `json:"-" gorm:"type:text[] NOT NULL;default: '{}'::text[]"` // The ETags of the uploaded parts of a multipart upload, ordered by part number.
+	ErrorReason string             `json:"-"`                                                   // Why the upload was marked as FileUploadStatusError, if it was.
+	ObjectName  string             `json:"-"`                                                   // The name of the object holding the contents, if it differs from FileName (e.g.: because it was deduplicated).
+}
+
+// GetObjectName returns the name of the object that holds the contents of the descriptor.
+func (f *FileDescriptor) GetObjectName() string {
+	if f.ObjectName != "" {
+		return f.ObjectName
+	}
+
+	return f.FileName
+}
+
+// MatchesMd5 returns whether the hex-encoded MD5 of an object (as returned by HashFile) matches the MD5 the descriptor
+// was announced with. Descriptors announced without an MD5 never match.
+func (f *FileDescriptor) MatchesMd5(md5Hex string) bool {
+	b, err := base64.StdEncoding.DecodeString(f.Md5)
+	if err != nil || len(b) != md5.Size {
+		return false
+	}
+
+	return strings.EqualFold(hex.EncodeToString(b), md5Hex)
+}
+
+// GetDescriptor returns a pointer to the descriptor of the provided type, or nil if the type is invalid.
+func (f *FileVersion) GetDescriptor(t FileDescriptorType) *FileDescriptor {
+	switch t {
+	case FileDescriptorTypeFile:
+		return &f.FileDescriptor
+	case FileDescriptorTypeDelta:
+		return &f.DeltaDescriptor
+	case FileDescriptorTypeSignature:
+		return &f.SignatureDescriptor
+	default:
+		return nil
+	}
 }
 
 func (f *FileDescriptor) BeforeCreate(*gorm.DB) (err error) {
@@ -196,6 +281,7 @@ type APIFileDescriptor struct {
 	Status      FileUploadStatus   `json:"status"`
 	Category    FileUploadCategory `json:"category"`
 	UploadId    string             `json:"uploadId"`
+	Error       string             `json:"error,omitempty"` // Why the upload failed verification, if it did.
 }
 
 func (f *File) GetAPIFile() *APIFile {
@@ -253,5 +339,192 @@ func (f *FileDescriptor) GetAPIFileDescriptor() *APIFileDescriptor {
 		Status:      f.Status,
 		Category:    f.Category,
 		UploadId:    f.UploadId,
+		Error:       f.ErrorReason,
+	}
+}
+
+// FileObject is an object in storage. Objects are shared by every complete descriptor with the same contents, and are
+// only deleted once the last descriptor referencing them is.
+type FileObject struct {
+	Name           string `gorm:"primarykey"`
+	Md5            string `gorm:"index"`
+	Sha256         string `gorm:"index"` // Empty if the object could not be hashed, in which case it is never deduplicated against.
+	SizeInBytes    int
+	ReferenceCount int
+	CreatedAt      int64
+	UpdatedAt      int64
+}
+
+// FindOwnedFileObject returns an object with the MD5 & size which the user already references through one of their own
+// files. Only objects the user is known to possess are returned, as knowing the MD5 of a file is no proof of having it.
+func FindOwnedFileObject(ownerId, md5 string, size int) (*FileObject, error) {
+	var o *FileObject
+
+	err := config.DB.Where("md5 = ? AND size_in_bytes = ? AND sha256 <> ''", md5, size).
+		Where(`EXISTS (SELECT 1 FROM file_descriptors fd JOIN files f ON f.id = fd.file_id AND f.deleted_at IS NULL
+			WHERE fd.deleted_at IS NULL AND f.owner_id = ? AND COALESCE(NULLIF(fd.object_name, ''), fd.file_name) = file_objects.name)`, ownerId).
+		First(&o).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// LinkFileObject points the (complete) descriptor at an object with the SHA-256 & size, taking a reference to it. If
+// there is none yet, the object the descriptor was uploaded to is registered instead. The name of the object that is
+// now referenced is returned; if it differs from FileName, the uploaded object is a duplicate & can be deleted.
+func LinkFileObject(tx *gorm.DB, fd *FileDescriptor, sha256 string) (string, error) {
+	var o *FileObject
+
+	if sha256 != "" {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("sha256 = ? AND size_in_bytes = ?", sha256, fd.SizeInBytes).
+			First(&o).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return "", err
+		}
+	}
+
+	if o == nil || o.Name == "" {
+		o = &FileObject{Name: fd.FileName, Md5: fd.Md5, Sha256: sha256, SizeInBytes: fd.SizeInBytes, ReferenceCount: 1}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"reference_count": gorm.Expr("file_objects.reference_count + 1")}),
+		}).Create(o).Error; err != nil {
+			return "", err
+		}
+	} else if err := AcquireFileObject(tx, o.Name); err != nil {
+		return "", err
+	}
+
+	if err := tx.Model(fd).Update("object_name", o.Name).Error; err != nil {
+		return "", err
 	}
+	fd.ObjectName = o.Name
+
+	return o.Name, nil
+}
+
+// AcquireFileObject takes a reference to the object.
+func AcquireFileObject(tx *gorm.DB, name string) error {
+	return tx.Model(&FileObject{}).Where("name = ?", name).
+		Update("reference_count", gorm.Expr("reference_count + 1")).Error
+}
+
+// ReleaseFileObject gives up a reference to the object that holds the contents of the (complete) descriptor, and
+// returns whether it was the last one, in which case the object should be deleted from storage. Descriptors completed
+// before objects were reference-counted have no object registered, and always hold the last reference to their own.
+func ReleaseFileObject(tx *gorm.DB, fd *FileDescriptor) (bool, error) {
+	var o *FileObject
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", fd.GetObjectName()).First(&o).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+
+	if o.ReferenceCount > 1 {
+		return false, tx.Model(o).Update("reference_count", o.ReferenceCount-1).Error
+	}
+
+	return true, tx.Delete(o).Error
+}
+
+// StorageUsage describes how much storage a user is using, and how much they are allowed to use. Limits of 0 mean that
+// there is no limit.
+type StorageUsage struct {
+	UsedBytes          int64 `json:"usedBytes"`
+	QuotaBytes         int64 `json:"quotaBytes"`
+	Files              int64 `json:"files"`
+	MaxFiles           int64 `json:"maxFiles"`
+	MaxWorldSizeBytes  int64 `json:"maxWorldSizeBytes"`
+	MaxAvatarSizeBytes int64 `json:"maxAvatarSizeBytes"`
+	MaxImageSizeBytes  int64 `json:"maxImageSizeBytes"`
+}
+
+// GetStorageUsage returns the storage usage of the user. Descriptors which are still being uploaded count towards it,
+// as their space is reserved when the file version is created.
+func GetStorageUsage(u *User) (*StorageUsage, error) {
+	var s = &StorageUsage{
+		QuotaBytes:         u.StorageQuotaBytes(),
+		MaxFiles:           u.StorageMaxFiles(),
+		MaxWorldSizeBytes:  config.ApiConfiguration.FilesMaxWorldSizeBytes.Get(),
+		MaxAvatarSizeBytes: config.ApiConfiguration.FilesMaxAvatarSizeBytes.Get(),
+		MaxImageSizeBytes:  config.ApiConfiguration.FilesMaxImageSizeBytes.Get(),
+	}
+
+	err := config.DB.Model(&FileDescriptor{}).
+		Joins("JOIN files ON files.id = file_descriptors.file_id AND files.deleted_at IS NULL").
+		Where("files.owner_id = ? AND file_descriptors.status IN ?", u.ID, []FileUploadStatus{FileUploadStatusWaiting, FileUploadStatusComplete}).
+		Select("COALESCE(SUM(file_descriptors.size_in_bytes), 0)").
+		Scan(&s.UsedBytes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.DB.Model(&File{}).Where("owner_id = ?", u.ID).Count(&s.Files).Error; err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetStorageUsageByUserId returns the storage usage of the user with the id.
+func GetStorageUsageByUserId(id string) (*StorageUsage, error) {
+	var u *User
+	if err := config.DB.Omit(clause.Associations).Where("id = ?", id).First(&u).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return GetStorageUsage(u)
+}
+
+// CanStore checks whether storing an additional amount of bytes would exceed the quota.
+func (s *StorageUsage) CanStore(bytes int64) error {
+	if s.QuotaBytes > 0 && s.UsedBytes+bytes > s.QuotaBytes {
+		return ErrStorageQuotaExceeded
+	}
+
+	return nil
+}
+
+// CanCreateFile checks whether creating another file would exceed the maximum amount of files.
+func (s *StorageUsage) CanCreateFile() error {
+	if s.MaxFiles > 0 && s.Files >= s.MaxFiles {
+		return ErrStorageFileLimitReached
+	}
+
+	return nil
+}
+
+// MaxUploadSize returns the maximum size of a single upload for the file, based on its type, or 0 if there is none.
+func (f *File) MaxUploadSize() int64 {
+	switch f.Extension {
+	case ".vrcw":
+		return config.ApiConfiguration.FilesMaxWorldSizeBytes.Get()
+	case ".vrca":
+		return config.ApiConfiguration.FilesMaxAvatarSizeBytes.Get()
+	case ".png", ".jpg", ".jpeg":
+		return config.ApiConfiguration.FilesMaxImageSizeBytes.Get()
+	default:
+		return 0
+	}
+}
+
+// CheckUploadSize checks whether an upload of the size is allowed for the file.
+func (f *File) CheckUploadSize(size int64) error {
+	if m := f.MaxUploadSize(); m > 0 && size > m {
+		return ErrFileTooLarge
+	}
+
+	return nil
 }
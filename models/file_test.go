@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestFileDescriptorMatchesMd5(t *testing.T) {
+	tests := []struct {
+		name   string
+		md5    string
+		md5Hex string
+		want   bool
+	}{
+		{name: "match", md5: "1B2M2Y8AsgTpgAmY7PhCfg==", md5Hex: "d41d8cd98f00b204e9800998ecf8427e", want: true},
+		{name: "case insensitive", md5: "1B2M2Y8AsgTpgAmY7PhCfg==", md5Hex: "D41D8CD98F00B204E9800998ECF8427E", want: true},
+		{name: "mismatch", md5: "1B2M2Y8AsgTpgAmY7PhCfg==", md5Hex: "9e107d9d372bb6826bd81d3542a419d6", want: false},
+		{name: "no md5 announced", md5: "", md5Hex: "d41d8cd98f00b204e9800998ecf8427e", want: false},
+		{name: "no md5 computed", md5: "1B2M2Y8AsgTpgAmY7PhCfg==", md5Hex: "", want: false},
+		{name: "not base64", md5: "d41d8cd98f00b204e9800998ecf8427e", md5Hex: "d41d8cd98f00b204e9800998ecf8427e", want: false},
+		{name: "not an md5", md5: "aGVsbG8=", md5Hex: "68656c6c6f", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &FileDescriptor{Md5: tt.md5}
+			if got := f.MatchesMd5(tt.md5Hex); got != tt.want {
+				t.Errorf("MatchesMd5(%q) = %v, want %v", tt.md5Hex, got, tt.want)
+			}
+		})
+	}
+}
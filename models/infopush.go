@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gitlab.com/george/shoya-go/config"
+	"sort"
+	"time"
+)
+
+// InfoPushesRedisKey is the key config.ApiConfig.InfoPushes is stored under.
+const InfoPushesRedisKey = "{config}:infoPushes"
+
+// GetInfoPushes returns all pushes (including disabled & scheduled ones) as currently stored in Redis, ordered by
+// priority.
+func GetInfoPushes() ([]config.ApiInfoPush, error) {
+	s, err := config.HarvestRedisClient.Get(context.Background(), InfoPushesRedisKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	pushes, err := parseInfoPushes(s)
+	if err != nil {
+		return nil, err
+	}
+
+	SortInfoPushes(pushes)
+	return pushes, nil
+}
+
+// GetInfoPush returns the push with the id.
+func GetInfoPush(id string) (*config.ApiInfoPush, error) {
+	pushes, err := GetInfoPushes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pushes {
+		if p.Id == id {
+			return &p, nil
+		}
+	}
+
+	return nil, ErrInfoPushNotFound
+}
+
+// SortInfoPushes orders the pushes by priority (highest first), then by creation date (newest first).
+func SortInfoPushes(pushes []config.ApiInfoPush) {
+	sort.SliceStable(pushes, func(i, j int) bool {
+		if pushes[i].Priority != pushes[j].Priority {
+			return pushes[i].Priority > pushes[j].Priority
+		}
+
+		return pushes[i].CreatedAt > pushes[j].CreatedAt
+	})
+}
+
+// CreateInfoPush stores a new push, assigning its id, hash & timestamps. The change is recorded as made by who.
+func CreateInfoPush(p config.ApiInfoPush, who string) (*config.ApiInfoPush, error) {
+	if err := ValidateInfoPush(&p); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	p.Id = "ip_" + uuid.New().String()
+	p.Hash = infoPushHash(&p)
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	if p.ReleaseStatus == "" {
+		p.ReleaseStatus = string(ReleaseStatusPublic)
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+
+	err := modifyInfoPushes(who, func(pushes []config.ApiInfoPush) ([]config.ApiInfoPush, error) {
+		return append(pushes, p), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// UpdateInfoPush applies fn to the push with the id, then refreshes its hash & update timestamp.
+func UpdateInfoPush(id, who string, fn func(p *config.ApiInfoPush)) (*config.ApiInfoPush, error) {
+	var updated config.ApiInfoPush
+	err := modifyInfoPushes(who, func(pushes []config.ApiInfoPush) ([]config.ApiInfoPush, error) {
+		for i := range pushes {
+			if pushes[i].Id != id {
+				continue
+			}
+
+			fn(&pushes[i])
+			if err := ValidateInfoPush(&pushes[i]); err != nil {
+				return nil, err
+			}
+
+			pushes[i].Hash = infoPushHash(&pushes[i])
+			pushes[i].UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+			updated = pushes[i]
+			return pushes, nil
+		}
+
+		return nil, ErrInfoPushNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// DeleteInfoPush removes the push with the id.
+func DeleteInfoPush(id, who string) error {
+	return modifyInfoPushes(who, func(pushes []config.ApiInfoPush) ([]config.ApiInfoPush, error) {
+		for i := range pushes {
+			if pushes[i].Id == id {
+				return append(pushes[:i], pushes[i+1:]...), nil
+			}
+		}
+
+		return nil, ErrInfoPushNotFound
+	})
+}
+
+// ValidateInfoPush checks that the start & end dates of the push are valid.
+func ValidateInfoPush(p *config.ApiInfoPush) error {
+	var start, end time.Time
+	var err error
+
+	if p.StartDate != "" {
+		if start, err = time.Parse(time.RFC3339, p.StartDate); err != nil {
+			return ErrInvalidInfoPushDate
+		}
+	}
+
+	if p.EndDate != "" {
+		if end, err = time.Parse(time.RFC3339, p.EndDate); err != nil {
+			return ErrInvalidInfoPushDate
+		}
+	}
+
+	if p.StartDate != "" && p.EndDate != "" && !end.After(start) {
+		return ErrInfoPushEndsBeforeStart
+	}
+
+	return nil
+}
+
+// MatchesInfoPushTags returns whether the push has all the required tags and, if any are given, at least one of the
+// included tags.
+func MatchesInfoPushTags(p *config.ApiInfoPush, required, included []string) bool {
+	tags := map[string]bool{}
+	for _, t := range p.Tags {
+		tags[t] = true
+	}
+
+	for _, t := range required {
+		if !tags[t] {
+			return false
+		}
+	}
+
+	if len(included) == 0 {
+		return true
+	}
+
+	for _, t := range included {
+		if tags[t] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// infoPushHash returns the hash of the content of the push, which clients use to tell whether they have seen it.
+func infoPushHash(p *config.ApiInfoPush) string {
+	b, _ := json.Marshal(p.Data)
+	h := md5.Sum(b)
+	return hex.EncodeToString(h[:])
+}
+
+// parseInfoPushes parses the pushes as stored in Redis.
+func parseInfoPushes(s string) ([]config.ApiInfoPush, error) {
+	var pushes []config.ApiInfoPush
+	if s == "" {
+		return pushes, nil
+	}
+
+	if err := json.Unmarshal([]byte(s), &pushes); err != nil {
+		return nil, err
+	}
+
+	return pushes, nil
+}
+
+// modifyInfoPushes atomically replaces the stored pushes with the result of fn, recording the change as made by who.
+func modifyInfoPushes(who string, fn func(pushes []config.ApiInfoPush) ([]config.ApiInfoPush, error)) error {
+	var pushes []config.ApiInfoPush
+	s, err := modifyConfigValue(InfoPushesRedisKey, who, &pushes, func() error {
+		var err error
+		if pushes, err = fn(pushes); err != nil {
+			return err
+		}
+
+		if pushes == nil {
+			pushes = []config.ApiInfoPush{}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The harvester picks the change up eventually; applying it right away keeps this instance consistent.
+	return config.ApiConfiguration.InfoPushes.SetString(s)
+}
@@ -1,9 +1,17 @@
 package models
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"gitlab.com/george/shoya-go/config"
+	"math/big"
 	"time"
 )
 
@@ -33,6 +41,21 @@ type WorldInstance struct {
 	BlockedPlayers []WorldInstanceBlockedPlayers `json:"blockedPlayers"` // A list of players who are blocked from joining & until when
 }
 
+// WorldOccupancy is the aggregated amount of players in the live instances of a world.
+type WorldOccupancy struct {
+	WorldID          string `json:"worldId"`
+	Occupants        int    `json:"occupants"`
+	PublicOccupants  int    `json:"publicOccupants"`
+	PrivateOccupants int    `json:"privateOccupants"` // Players in any non-public instance
+}
+
+// WorldInstances is the list of joinable public instances & the occupancy of a world, as returned by the batch lookup
+// in Discovery.
+type WorldInstances struct {
+	Instances []*WorldInstance `json:"instances"`
+	Occupancy WorldOccupancy   `json:"occupancy"`
+}
+
 type InstanceJoinJWTClaims struct {
 	JoinId              string   `json:"joinId"`
 	UserId              string   `json:"userId"`
@@ -49,8 +72,231 @@ type InstanceJoinJWTClaims struct {
 	jwt.StandardClaims
 }
 
-func CreateJoinToken(u *User, w *World, ip string, location *Location) (string, error) {
-	// TODO: Check whether location.IsStrict & check against presence service when made.
+// InstanceInviteTtl is how long an invite to an instance remains valid for.
+const InstanceInviteTtl = time.Hour
+
+// InstanceShortNameTtl is how long the short name of an instance remains resolvable for.
+const InstanceShortNameTtl = 24 * time.Hour
+
+const instanceShortNameAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+const instanceShortNameLength = 8
+
+// CreateLocation mints a new location for the provided world. Non-public locations are signed with a server-issued
+// nonce, which ties the owner & privacy settings to the location.
+func CreateLocation(worldId, instanceType, ownerId, region string, canRequestInvite, isStrict bool) (*Location, error) {
+	if !isAllowedInstanceType(instanceType) {
+		return nil, ErrInvalidInstanceType
+	}
+
+	if region == "" {
+		region = "usw"
+	}
+
+	if !isAllowedInstanceRegion(region) {
+		return nil, ErrInvalidInstanceRegion
+	}
+
+	if instanceType == "public" && (canRequestInvite || isStrict) {
+		return nil, ErrInvalidInstanceType
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(90000))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Location{
+		WorldID:          worldId,
+		InstanceID:       fmt.Sprintf("%05d", n.Int64()+10000),
+		InstanceType:     instanceType,
+		Region:           region,
+		CanRequestInvite: canRequestInvite,
+		IsStrict:         isStrict,
+	}
+
+	l.LocationString = l.InstanceID
+	if instanceType != "public" {
+		l.OwnerID = ownerId
+		l.LocationString += fmt.Sprintf("~%s(%s)", instanceType, ownerId)
+		if canRequestInvite {
+			l.LocationString += "~canRequestInvite"
+		}
+	}
+
+	l.LocationString += fmt.Sprintf("~region(%s)", region)
+	if instanceType != "public" {
+		l.Nonce = l.GenerateNonce()
+		l.LocationString += fmt.Sprintf("~nonce(%s)", l.Nonce)
+	}
+
+	if isStrict {
+		l.LocationString += "~strict"
+	}
+
+	l.ID = fmt.Sprintf("%s:%s", worldId, l.LocationString)
+	return l, nil
+}
+
+// GenerateNonce returns the server-issued nonce for this location; an HMAC over everything that determines who may join.
+func (l *Location) GenerateNonce() string {
+	h := hmac.New(sha256.New, []byte(config.ApiConfiguration.JwtSecret.Get()))
+	h.Write([]byte(fmt.Sprintf("%s:%s~%s(%s)~region(%s)~canRequestInvite(%t)~strict(%t)", l.WorldID, l.InstanceID, l.InstanceType, l.OwnerID, l.Region, l.CanRequestInvite, l.IsStrict)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// IsNonceValid returns whether the location carries a nonce that was issued by this server.
+func (l *Location) IsNonceValid() bool {
+	if l.Nonce == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(l.Nonce), []byte(l.GenerateNonce()))
+}
+
+// CanJoin checks whether the user is allowed to join the instance at this location. instance is the live instance as
+// known by Discovery, if any.
+func (l *Location) CanJoin(u *User, instance *WorldInstance) error {
+	var players []string
+	if l.InstanceType == "public" {
+		return nil
+	}
+
+	if l.Nonce == "" {
+		return ErrInstanceMissingNonce
+	}
+
+	if u.ID == l.OwnerID || u.IsStaff() {
+		return nil
+	}
+
+	// Client-constructed locations are only trusted once they are live, which requires the owner to have joined them.
+	// Otherwise, anyone could claim an instance in the name of someone else.
+	if instance == nil && !l.IsNonceValid() {
+		return ErrInstanceInvalidNonce
+	}
+
+	if instance != nil {
+		players = instance.Players
+	}
+
+	isFriendsWithOwner := u.IsFriendsWith(l.OwnerID)
+	if l.IsStrict && !isFriendsWithOwner {
+		return ErrInstanceNotFriendsWithOwner
+	}
+
+	// Invites grant access to any non-public instance that the user could otherwise not join (strict notwithstanding).
+	if HasInstanceInvite(u.ID, l.ID) {
+		return nil
+	}
+
+	switch l.InstanceType {
+	case "friends":
+		if !isFriendsWithOwner {
+			return ErrInstanceNotFriendsWithOwner
+		}
+	case "hidden":
+		if isFriendsWithOwner {
+			return nil
+		}
+
+		for _, player := range players {
+			if u.IsFriendsWith(player) {
+				return nil
+			}
+		}
+
+		return ErrInstanceNoFriendsInInstance
+	case "private":
+		return ErrInstanceNotInvited
+	}
+
+	return nil
+}
+
+// CreateInstanceShortName creates a short name that resolves to the provided location.
+func CreateInstanceShortName(location string) (string, error) {
+	b := make([]byte, instanceShortNameLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(instanceShortNameAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = instanceShortNameAlphabet[n.Int64()]
+	}
+
+	shortName := string(b)
+	err := config.RedisClient.Set(context.Background(), "instanceShortNames:"+shortName, location, InstanceShortNameTtl).Err()
+	if err != nil {
+		return "", err
+	}
+
+	err = config.RedisClient.Set(context.Background(), "instanceShortNames:location:"+location, shortName, InstanceShortNameTtl).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return shortName, nil
+}
+
+// GetLocationForShortName resolves a short name to the location it was created for.
+func GetLocationForShortName(shortName string) (string, error) {
+	l, err := config.RedisClient.Get(context.Background(), "instanceShortNames:"+shortName).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", ErrInstanceShortNameNotFound
+		}
+		return "", err
+	}
+
+	return l, nil
+}
+
+// GetShortNameForLocation returns the short name of a location, or an empty string if it has none.
+func GetShortNameForLocation(location string) string {
+	s, err := config.RedisClient.Get(context.Background(), "instanceShortNames:location:"+location).Result()
+	if err != nil {
+		return ""
+	}
+
+	return s
+}
+
+// CreateInstanceInvite records an invite for the user to the instance at the provided location.
+func CreateInstanceInvite(userId, location string) error {
+	return config.RedisClient.Set(context.Background(), instanceInviteKey(userId, location), 1, InstanceInviteTtl).Err()
+}
+
+// HasInstanceInvite returns whether the user has a valid invite to the instance at the provided location.
+func HasInstanceInvite(userId, location string) bool {
+	n, err := config.RedisClient.Exists(context.Background(), instanceInviteKey(userId, location)).Result()
+	if err != nil {
+		return false
+	}
+
+	return n == 1
+}
+
+func instanceInviteKey(userId, location string) string {
+	return fmt.Sprintf("invites:%s:%s", location, userId)
+}
+
+// IsInstanceAccessError returns whether the error was returned because a user is not allowed to join an instance.
+func IsInstanceAccessError(err error) bool {
+	switch err {
+	case ErrInstanceMissingNonce, ErrInstanceInvalidNonce, ErrInstanceNotFriendsWithOwner, ErrInstanceNoFriendsInInstance, ErrInstanceNotInvited:
+		return true
+	}
+
+	return false
+}
+
+// CreateJoinToken creates a join token for the provided location if the user is allowed to join it. instance is the live
+// instance as known by Discovery, if any.
+func CreateJoinToken(u *User, w *World, ip string, location *Location, instance *WorldInstance) (string, error) {
+	if err := location.CanJoin(u, instance); err != nil {
+		return "", err
+	}
+
 	joinId, _ := uuid.NewUUID()
 	claims := InstanceJoinJWTClaims{
 		JoinId:          "join_" + joinId.String(),
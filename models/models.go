@@ -137,6 +137,30 @@ var (
 var AllowedInstanceTypes = []string{"hidden", "friends", "private"}
 var AllowedInstanceRegions = []string{"us", "usw", "use", "eu", "jp"}
 
+func isAllowedInstanceType(instanceType string) bool {
+	if instanceType == "public" {
+		return true
+	}
+
+	for _, allowedInstanceType := range AllowedInstanceTypes {
+		if allowedInstanceType == instanceType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isAllowedInstanceRegion(region string) bool {
+	for _, allowedInstanceRegion := range AllowedInstanceRegions {
+		if allowedInstanceRegion == region {
+			return true
+		}
+	}
+
+	return false
+}
+
 type Location struct {
 	ID               string `json:"id"`
 	WorldID          string `json:"worldId"`          // WorldID is the id of the world the instance is for.
@@ -2,6 +2,7 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"github.com/tj/go-naturaldate"
 	"gitlab.com/george/shoya-go/config"
 	"gorm.io/gorm"
 	"strings"
@@ -77,6 +78,53 @@ func (m *Moderation) GetTarget() (*User, error) {
 	return &u, nil
 }
 
+// IsActive returns whether the moderation is permanent or has not expired yet.
+func (m *Moderation) IsActive(now time.Time) bool {
+	return m.ExpiresAt == 0 || m.ExpiresAt > now.UTC().Unix()
+}
+
+// ParseModerationExpiry parses the natural-language expiry of a moderation (e.g.: "in 2 weeks", or "in_2_weeks" as sent
+// by the client) relative to now. Expiries in the past are rejected.
+func ParseModerationExpiry(expiry string, now time.Time) (time.Time, error) {
+	exp, err := naturaldate.Parse(strings.ReplaceAll(expiry, "_", " "), now.UTC(), naturaldate.WithDirection(naturaldate.Future))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if exp.Before(now.UTC()) {
+		return time.Time{}, ErrModerationInThePast
+	}
+
+	return exp, nil
+}
+
+// GetModerations returns the moderations against the user, newest first. Expired ones are only included if requested.
+func GetModerations(targetId string, includeExpired bool) ([]Moderation, error) {
+	var mods []Moderation
+
+	tx := config.DB.Where("target_id = ?", targetId)
+	if !includeExpired {
+		tx = tx.Where("expires_at = 0 OR expires_at > ?", time.Now().UTC().Unix())
+	}
+
+	if err := tx.Order("created_at DESC").Find(&mods).Error; err != nil {
+		return nil, err
+	}
+
+	return mods, nil
+}
+
+// LiftBans expires the active bans of the user, and returns how many were lifted.
+func LiftBans(targetId string) (int64, error) {
+	now := time.Now().UTC().Unix()
+	tx := config.DB.Model(&Moderation{}).
+		Where("target_id = ? AND type = ?", targetId, ModerationBan).
+		Where("expires_at = 0 OR expires_at > ?", now).
+		Update("expires_at", now)
+
+	return tx.RowsAffected, tx.Error
+}
+
 // BeforeCreate is a hook called before the database entry is created.
 // It generates a UUID for the PlayerModeration.
 func (m *Moderation) BeforeCreate(*gorm.DB) (err error) {
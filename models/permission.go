@@ -1,8 +1,54 @@
 package models
 
+import (
+	"github.com/google/uuid"
+	"gitlab.com/george/shoya-go/config"
+	"gorm.io/gorm"
+)
+
 type Permission struct {
 	BaseModel
 	UserID    string
 	Name      string `json:"name"`
 	CreatedBy string
 }
+
+// BeforeCreate is a hook called before the database entry is created.
+// It generates a UUID for the Permission.
+func (p *Permission) BeforeCreate(*gorm.DB) (err error) {
+	p.ID = "perm_" + uuid.New().String()
+	return
+}
+
+// GrantPermission grants the permission to the user, recording who granted it.
+func GrantPermission(userId, name, createdBy string) (*Permission, error) {
+	var n int64
+	if err := config.DB.Model(&Permission{}).Where("user_id = ? AND name = ?", userId, name).Count(&n).Error; err != nil {
+		return nil, err
+	}
+
+	if n != 0 {
+		return nil, ErrPermissionAlreadyGranted
+	}
+
+	p := &Permission{UserID: userId, Name: name, CreatedBy: createdBy}
+	if err := config.DB.Create(p).Error; err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// RevokePermission revokes the permission from the user.
+func RevokePermission(userId, name string) error {
+	tx := config.DB.Where("user_id = ? AND name = ?", userId, name).Delete(&Permission{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		return ErrPermissionNotGranted
+	}
+
+	return nil
+}
@@ -31,6 +31,9 @@ const (
 	UserStatusBusy    UserStatus = "busy"
 )
 
+// UserDeveloperTypes are the developer types a user can have. Internal developers may see hidden content.
+var UserDeveloperTypes = []string{"none", "trusted", "internal", "moderator"}
+
 func NewUserStatus(s string) UserStatus {
 	switch s {
 	case "offline":
@@ -89,6 +92,26 @@ type User struct {
 	ProfilePicOverride            string          `json:"profilePicOverride"`
 	Unsubscribe                   bool            `json:"unsubscribe"`
 	UserIcon                      string          `json:"userIcon"`
+	StorageQuotaBytesOverride     *int64          `json:"-"` // Overrides FilesUserQuotaBytes for this user, if set (by staff).
+	StorageMaxFilesOverride       *int64          `json:"-"` // Overrides FilesUserMaxFiles for this user, if set (by staff).
+}
+
+// StorageQuotaBytes returns the total size of the files the user may store, or 0 if there is no limit.
+func (u *User) StorageQuotaBytes() int64 {
+	if u.StorageQuotaBytesOverride != nil {
+		return *u.StorageQuotaBytesOverride
+	}
+
+	return config.ApiConfiguration.FilesUserQuotaBytes.Get()
+}
+
+// StorageMaxFiles returns the amount of files the user may create, or 0 if there is no limit.
+func (u *User) StorageMaxFiles() int64 {
+	if u.StorageMaxFilesOverride != nil {
+		return *u.StorageMaxFilesOverride
+	}
+
+	return config.ApiConfiguration.FilesUserMaxFiles.Get()
 }
 
 func GetUserById(id string) (*User, error) {
@@ -199,9 +222,11 @@ func NewUser(username, displayName, email, password string) *User {
 }
 
 // BeforeCreate is a hook called before the database entry is created.
-// It generates a UUID for the user.
+// It generates a UUID for the user, unless one was already assigned.
 func (u *User) BeforeCreate(*gorm.DB) (err error) {
-	u.ID = "usr_" + uuid.New().String() // TODO: Possibly do a database lookup to see whether the UUID already exists.
+	if u.ID == "" {
+		u.ID = "usr_" + uuid.New().String() // TODO: Possibly do a database lookup to see whether the UUID already exists.
+	}
 	return
 }
 
@@ -265,6 +290,11 @@ func (u *User) CanUploadWorlds() bool {
 	return false
 }
 
+// IsFriendsWith returns whether the user is friends with the user with the provided id.
+func (u *User) IsFriendsWith(id string) bool { // WIP -- skipcq
+	return false // TODO: Implement friendship system.
+}
+
 // GetState returns the state of the user from the presence service.
 func (u *User) GetState() UserState { // WIP -- skipcq
 	return UserStateActive // TODO: Implement presence service.
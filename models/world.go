@@ -1,6 +1,8 @@
 package models
 
 import (
+	"context"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gitlab.com/george/shoya-go/config"
@@ -24,7 +26,9 @@ type World struct {
 }
 
 func (w *World) BeforeCreate(*gorm.DB) (err error) {
-	w.ID = "wrld_" + uuid.New().String()
+	if w.ID == "" {
+		w.ID = "wrld_" + uuid.New().String()
+	}
 	return
 }
 
@@ -52,6 +56,69 @@ func GetWorldById(id string) (*World, error) {
 	return w, nil
 }
 
+// GetWorldsByIds returns the worlds with the provided ids, in the order the ids were provided in.
+// Ids that do not belong to a world are skipped.
+func GetWorldsByIds(ids []string) ([]World, error) {
+	var worlds []World
+	var r = make([]World, 0, len(ids))
+
+	if len(ids) == 0 {
+		return r, nil
+	}
+
+	tx := config.DB.Preload(clause.Associations).
+		Preload("Image").
+		Preload("Image.Versions").
+		Preload("Image.Versions.FileDescriptor").
+		Preload("Image.Versions.DeltaDescriptor").
+		Preload("Image.Versions.SignatureDescriptor").
+		Preload("UnityPackages.File").
+		Preload("UnityPackages.File.Versions").
+		Preload("UnityPackages.File.Versions.FileDescriptor").
+		Preload("UnityPackages.File.Versions.DeltaDescriptor").
+		Preload("UnityPackages.File.Versions.SignatureDescriptor").
+		Where("id IN ?", ids).Find(&worlds)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	byId := make(map[string]World, len(worlds))
+	for _, w := range worlds {
+		byId[w.ID] = w
+	}
+
+	for _, id := range ids {
+		if w, ok := byId[id]; ok {
+			r = append(r, w)
+		}
+	}
+
+	return r, nil
+}
+
+// RecentWorldsLimit is the amount of recently visited worlds that are kept for each user.
+const RecentWorldsLimit = 50
+
+// AddRecentWorld marks the world as the most recently visited world of the user.
+func AddRecentWorld(userId, worldId string) error {
+	var ctx = context.Background()
+	var key = "recentWorlds:" + userId
+
+	_, err := config.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, key, 0, worldId)
+		pipe.LPush(ctx, key, worldId)
+		pipe.LTrim(ctx, key, 0, RecentWorldsLimit-1)
+		return nil
+	})
+
+	return err
+}
+
+// GetRecentWorlds returns the ids of the worlds the user has most recently visited, most recent first.
+func GetRecentWorlds(userId string) ([]string, error) {
+	return config.RedisClient.LRange(context.Background(), "recentWorlds:"+userId, 0, RecentWorldsLimit-1).Result()
+}
+
 // GetAuthor returns a pointer to the world author's User.
 func (w *World) GetAuthor() (*User, error) {
 	var u User
@@ -69,9 +136,9 @@ func (w *World) GetImageUrl() string {
 	return w.Image.GetLatestVersion().GetFileUrl()
 }
 
-// GetThumbnailImageUrl returns the Url present in the Image field.
+// GetThumbnailImageUrl returns the Url of the thumbnail-sized variant of the Image.
 func (w *World) GetThumbnailImageUrl() string {
-	return w.Image.GetLatestVersion().GetFileUrl()
+	return w.Image.GetLatestVersion().GetImageUrl(ImageThumbnailWidth)
 }
 
 // GetLatestAssetUrl iterates through a World's UnityPackages and returns the Url present in the File
@@ -118,11 +185,11 @@ func (w *World) GetAPIWorld() (*APIWorld, error) {
 		PublicationDate:     time.Unix(w.CreatedAt, 0).Format(time.RFC3339),
 		LabsPublicationDate: "", // Intentionally hardcoded to an empty string; Will not implement.
 		Name:                w.Name,
-		Occupants:           0,        // TODO: Implement instances + overall occupancy.
+		Occupants:           0,        // Filled in from Discovery by the API.
 		Organization:        "vrchat", // It's *always* vrchat.
 		PreviewYoutubeId:    "",       // TODO: This is almost never used, and is only available on the web. Low priority.
-		PrivateOccupants:    0,        // TODO: Implement instances + overall occupancy.
-		PublicOccupants:     0,        // TODO: Implement instances + overall occupancy.
+		PrivateOccupants:    0,        // Filled in from Discovery by the API.
+		PublicOccupants:     0,        // Filled in from Discovery by the API.
 		ReleaseStatus:       w.ReleaseStatus,
 		Tags:                w.Tags,
 		ThumbnailImageUrl:   w.GetThumbnailImageUrl(),
@@ -0,0 +1,294 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"gitlab.com/george/shoya-go/config"
+	"sort"
+)
+
+// DynamicWorldRowsRedisKey is the key config.ApiConfig.DynamicWorldRows is stored under.
+const DynamicWorldRowsRedisKey = "{config}:dynamicWorldRows"
+
+// WorldStaffPicksRedisKey is the key config.ApiConfig.WorldStaffPicks is stored under.
+const WorldStaffPicksRedisKey = "{config}:worldStaffPicks"
+
+// WorldSort is a sort that /worlds (and therefore dynamic world rows) can be resolved with.
+// WorldSortPopular ("popular"): Worlds with the most players in them right now (requires the Discovery service).
+// WorldSortNew ("new"): Worlds by publication date.
+// WorldSortUpdated ("updated"): Worlds by when they were last updated.
+// WorldSortStaffPicks ("staffpicks"): The curated list of worlds in config.ApiConfig.WorldStaffPicks.
+// WorldSortName ("name"): Worlds by name.
+// WorldSortShuffle ("shuffle"): Worlds in random order.
+type WorldSort string
+
+const (
+	WorldSortPopular    WorldSort = "popular"
+	WorldSortNew        WorldSort = "new"
+	WorldSortUpdated    WorldSort = "updated"
+	WorldSortStaffPicks WorldSort = "staffpicks"
+	WorldSortName       WorldSort = "name"
+	WorldSortShuffle    WorldSort = "shuffle"
+)
+
+// worldSortAliases maps the sorts the client knows about to the sort they are resolved with.
+var worldSortAliases = map[string]WorldSort{
+	"popular":         WorldSortPopular,
+	"popularity":      WorldSortPopular,
+	"heat":            WorldSortPopular,
+	"active":          WorldSortPopular,
+	"new":             WorldSortNew,
+	"publicationDate": WorldSortNew,
+	"created":         WorldSortNew,
+	"_created_at":     WorldSortNew,
+	"updated":         WorldSortUpdated,
+	"_updated_at":     WorldSortUpdated,
+	"staffpicks":      WorldSortStaffPicks,
+	"featured":        WorldSortStaffPicks,
+	"name":            WorldSortName,
+	"shuffle":         WorldSortShuffle,
+	"random":          WorldSortShuffle,
+}
+
+// ParseWorldSort returns the sort a requested sort (or sort heading) is resolved with.
+func ParseWorldSort(s string) (WorldSort, error) {
+	if ws, ok := worldSortAliases[s]; ok {
+		return ws, nil
+	}
+
+	return "", ErrInvalidWorldSort
+}
+
+// GetDynamicWorldRows returns the rows as currently stored in Redis, ordered by their index.
+func GetDynamicWorldRows() ([]config.ApiDynamicWorldRow, error) {
+	var rows []config.ApiDynamicWorldRow
+	s, err := config.HarvestRedisClient.Get(context.Background(), DynamicWorldRowsRedisKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if s != "" {
+		if err = json.Unmarshal([]byte(s), &rows); err != nil {
+			return nil, err
+		}
+	}
+
+	sortDynamicWorldRows(rows)
+	return rows, nil
+}
+
+// AddDynamicWorldRow validates the row & adds it as the last row.
+func AddDynamicWorldRow(row config.ApiDynamicWorldRow, who string) (*config.ApiDynamicWorldRow, error) {
+	if err := validateDynamicWorldRow(&row); err != nil {
+		return nil, err
+	}
+
+	err := modifyDynamicWorldRows(who, func(rows []config.ApiDynamicWorldRow) ([]config.ApiDynamicWorldRow, error) {
+		row.Index = len(rows)
+		return append(rows, row), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &row, nil
+}
+
+// UpdateDynamicWorldRow applies fn to the row at the index & validates the result.
+func UpdateDynamicWorldRow(index int, who string, fn func(row *config.ApiDynamicWorldRow)) (*config.ApiDynamicWorldRow, error) {
+	var updated config.ApiDynamicWorldRow
+	err := modifyDynamicWorldRows(who, func(rows []config.ApiDynamicWorldRow) ([]config.ApiDynamicWorldRow, error) {
+		if index < 0 || index >= len(rows) {
+			return nil, ErrWorldRowNotFound
+		}
+
+		fn(&rows[index])
+		rows[index].Index = index
+		if err := validateDynamicWorldRow(&rows[index]); err != nil {
+			return nil, err
+		}
+
+		updated = rows[index]
+		return rows, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// MoveDynamicWorldRow moves the row at the index to another index, shifting the rows in between.
+func MoveDynamicWorldRow(from, to int, who string) error {
+	return modifyDynamicWorldRows(who, func(rows []config.ApiDynamicWorldRow) ([]config.ApiDynamicWorldRow, error) {
+		if from < 0 || from >= len(rows) || to < 0 || to >= len(rows) {
+			return nil, ErrWorldRowNotFound
+		}
+
+		row := rows[from]
+		rows = append(rows[:from], rows[from+1:]...)
+		rows = append(rows[:to], append([]config.ApiDynamicWorldRow{row}, rows[to:]...)...)
+		return rows, nil
+	})
+}
+
+// RemoveDynamicWorldRow removes the row at the index.
+func RemoveDynamicWorldRow(index int, who string) error {
+	return modifyDynamicWorldRows(who, func(rows []config.ApiDynamicWorldRow) ([]config.ApiDynamicWorldRow, error) {
+		if index < 0 || index >= len(rows) {
+			return nil, ErrWorldRowNotFound
+		}
+
+		return append(rows[:index], rows[index+1:]...), nil
+	})
+}
+
+// validateDynamicWorldRow checks that the row can be resolved, filling in defaults for its optional fields.
+func validateDynamicWorldRow(row *config.ApiDynamicWorldRow) error {
+	if row.Name == "" {
+		return ErrInvalidWorldRowName
+	}
+
+	if _, err := ParseWorldSort(row.SortHeading); err != nil {
+		return err
+	}
+
+	switch row.SortOrder {
+	case "":
+		row.SortOrder = "descending"
+	case "ascending", "descending":
+	default:
+		return ErrInvalidWorldSortOrder
+	}
+
+	switch row.SortOwnership {
+	case "":
+		row.SortOwnership = "any"
+	case "any", "mine":
+	default:
+		return ErrInvalidWorldSortOwnership
+	}
+
+	if row.Platform == "" {
+		row.Platform = "ThisPlatformSupported"
+	}
+
+	return nil
+}
+
+// sortDynamicWorldRows orders the rows by their index.
+func sortDynamicWorldRows(rows []config.ApiDynamicWorldRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Index < rows[j].Index
+	})
+}
+
+// modifyDynamicWorldRows atomically replaces the stored rows with the result of fn, which receives them ordered by
+// their index. The indexes of the rows are renumbered afterwards, and the change is recorded as made by who.
+func modifyDynamicWorldRows(who string, fn func(rows []config.ApiDynamicWorldRow) ([]config.ApiDynamicWorldRow, error)) error {
+	var rows []config.ApiDynamicWorldRow
+	s, err := modifyConfigValue(DynamicWorldRowsRedisKey, who, &rows, func() error {
+		var err error
+		sortDynamicWorldRows(rows)
+		if rows, err = fn(rows); err != nil {
+			return err
+		}
+
+		if rows == nil {
+			rows = []config.ApiDynamicWorldRow{}
+		}
+
+		for i := range rows {
+			rows[i].Index = i
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return config.ApiConfiguration.DynamicWorldRows.SetString(s)
+}
+
+// GetWorldStaffPicks returns the ids of the staff picked worlds as currently stored in Redis, in order.
+func GetWorldStaffPicks() ([]string, error) {
+	var ids []string
+	s, err := config.HarvestRedisClient.Get(context.Background(), WorldStaffPicksRedisKey).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if s != "" {
+		if err = json.Unmarshal([]byte(s), &ids); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// AddWorldStaffPick adds the world to the staff picks at the position (or at the end if the position is out of range),
+// moving it there if it already is one.
+func AddWorldStaffPick(id string, position int, who string) error {
+	if _, err := GetWorldById(id); err != nil {
+		return err
+	}
+
+	return modifyWorldStaffPicks(who, func(ids []string) ([]string, error) {
+		ids = removeString(ids, id)
+		if position < 0 || position > len(ids) {
+			position = len(ids)
+		}
+
+		return append(ids[:position], append([]string{id}, ids[position:]...)...), nil
+	})
+}
+
+// RemoveWorldStaffPick removes the world from the staff picks.
+func RemoveWorldStaffPick(id, who string) error {
+	return modifyWorldStaffPicks(who, func(ids []string) ([]string, error) {
+		r := removeString(ids, id)
+		if len(r) == len(ids) {
+			return nil, ErrWorldNotStaffPicked
+		}
+
+		return r, nil
+	})
+}
+
+// modifyWorldStaffPicks atomically replaces the stored staff picks with the result of fn, recording the change as made
+// by who.
+func modifyWorldStaffPicks(who string, fn func(ids []string) ([]string, error)) error {
+	var ids []string
+	s, err := modifyConfigValue(WorldStaffPicksRedisKey, who, &ids, func() error {
+		var err error
+		if ids, err = fn(ids); err != nil {
+			return err
+		}
+
+		if ids == nil {
+			ids = []string{}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return config.ApiConfiguration.WorldStaffPicks.SetString(s)
+}
+
+// removeString returns the slice without any occurrences of the string.
+func removeString(s []string, v string) []string {
+	r := make([]string, 0, len(s))
+	for _, e := range s {
+		if e != v {
+			r = append(r, e)
+		}
+	}
+
+	return r
+}
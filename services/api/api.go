@@ -13,10 +13,8 @@ import (
 	"github.com/gtsatsis/harvester"
 	"gitlab.com/george/shoya-go/config"
 	pb "gitlab.com/george/shoya-go/gen/v1/proto"
-	"gitlab.com/george/shoya-go/models"
+	"gitlab.com/george/shoya-go/migrations"
 	"gitlab.com/george/shoya-go/services/discovery/discovery_client"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	gormLogger "gorm.io/gorm/logger"
@@ -35,7 +33,7 @@ func Main() {
 	})
 	app.Use(recover.New())
 	app.Use(logger.New())
-	app.Use(AddXPoweredByHeader, IsGameRequestMiddleware)
+	app.Use(AddXPoweredByHeader, IsGameRequestMiddleware, ClientCompatibilityMiddleware)
 
 	initializeRoutes(app)
 
@@ -43,8 +41,8 @@ func Main() {
 }
 
 func shoyaInit() {
-	if config.RuntimeConfig.Api == nil {
-		log.Fatalf("error reading config: RuntimeConfig.Api was nil")
+	if err := config.RuntimeConfig.Require("api"); err != nil {
+		log.Fatalf("error reading config: %v", err)
 	}
 
 	initializeDB()
@@ -61,17 +59,20 @@ func shoyaInit() {
 
 func initializeRoutes(app *fiber.App) {
 	systemRoutes(app)
+	configRoutes(app)
 	authRoutes(app)
 	usersRoutes(app)
 	worldsRoutes(app)
+	worldRowsRoutes(app)
 	photonRoutes(app)
 	instanceRoutes(app)
+	inviteRoutes(app)
 	avatarsRoutes(app)
 	favoriteRoutes(app)
 	fileRoutes(app)
 }
 
-// initializeDB initializes the database connection (and runs migrations)
+// initializeDB initializes the database connection, refusing to start if the schema has not been migrated.
 func initializeDB() {
 	var err error
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Etc/GMT",
@@ -87,60 +88,8 @@ func initializeDB() {
 		panic(err)
 	}
 
-	err = config.DB.AutoMigrate(&models.User{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.Avatar{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.File{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.FavoriteGroup{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.FavoriteItem{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.Moderation{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.Permission{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(models.WorldUnityPackage{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.AvatarUnityPackage{})
-	if err != nil {
-		fmt.Println(err)
-	}
-	err = config.DB.AutoMigrate(&models.PlayerModeration{})
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	err = config.DB.AutoMigrate(&models.File{})
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	err = config.DB.AutoMigrate(&models.FileVersion{})
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	err = config.DB.AutoMigrate(&models.FileDescriptor{})
-	if err != nil {
-		fmt.Println(err)
+	if err = migrations.Check(config.DB); err != nil {
+		log.Fatalf("refusing to start: %v (run `shoya db migrate up` first)", err)
 	}
 }
 
@@ -188,9 +137,9 @@ func initializeHealthChecks() {
 }
 
 func initializeFilesClient() {
-	conn, err := grpc.Dial(config.ApiConfiguration.FilesEndpoint.Get(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	var err error
+	FilesService, err = DialFilesService(config.ApiConfiguration.FilesEndpoint.Get(), config.RuntimeConfig.Api.Files)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	FilesService = pb.NewFileClient(conn)
 }
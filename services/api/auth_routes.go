@@ -22,6 +22,7 @@ func authRoutes(r *fiber.App) {
 	user.Get("/friends", AuthMiddleware, getFriends)
 	user.Get("/moderations", AuthMiddleware, getModerations)
 	user.Get("/notifications", AuthMiddleware, getNotifications)
+	user.Get("/storage", AuthMiddleware, getSelfStorage)
 
 	user.Get("/playermoderations", AuthMiddleware, getPlayerModerations)
 	user.Post("/playermoderations", AuthMiddleware, postPlayerModerations)
@@ -144,7 +145,7 @@ func postRegister(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.Status(200).JSON(u.GetAPICurrentUser())
+	return clientJSON(c.Status(200), config.ApiClientPayloadUser, u.GetAPICurrentUser())
 }
 
 // getSelf | GET /auth/user
@@ -152,7 +153,20 @@ func postRegister(c *fiber.Ctx) error {
 func getSelf(c *fiber.Ctx) error {
 	var u = c.Locals("user").(*models.User)
 
-	return c.Status(200).JSON(u.GetAPICurrentUser())
+	return clientJSON(c.Status(200), config.ApiClientPayloadUser, u.GetAPICurrentUser())
+}
+
+// getSelfStorage | GET /auth/user/storage
+// Returns the current user's storage usage & limits.
+func getSelfStorage(c *fiber.Ctx) error {
+	var u = c.Locals("user").(*models.User)
+
+	usage, err := models.GetStorageUsage(u)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return c.JSON(usage)
 }
 
 // getFriends | GET /auth/user/friends
@@ -180,7 +180,7 @@ func getAvatars(c *fiber.Ctx) error {
 			}
 			apiAvatarsWithPackages = append(apiAvatarsWithPackages, ap)
 		}
-		return c.JSON(apiAvatarsWithPackages)
+		return clientJSON(c, config.ApiClientPayloadAvatar, apiAvatarsWithPackages)
 	} else {
 		for _, avatar := range avatars {
 			a, err := avatar.GetAPIAvatar()
@@ -190,7 +190,7 @@ func getAvatars(c *fiber.Ctx) error {
 			apiAvatars = append(apiAvatars, a)
 		}
 
-		return c.JSON(apiAvatars)
+		return clientJSON(c, config.ApiClientPayloadAvatar, apiAvatars)
 	}
 
 badRequest:
@@ -294,7 +294,7 @@ func postAvatars(c *fiber.Ctx) error {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
 
-	return c.JSON(aa)
+	return clientJSON(c, config.ApiClientPayloadAvatar, aa)
 }
 
 // getAvatarFavorites | GET /avatars/favorites
@@ -343,9 +343,9 @@ func getAvatar(c *fiber.Ctx) error {
 	}
 
 	if isGameRequest {
-		return c.JSON(aap)
+		return clientJSON(c, config.ApiClientPayloadAvatar, aap)
 	} else {
-		return c.JSON(aa)
+		return clientJSON(c, config.ApiClientPayloadAvatar, aa)
 	}
 }
 
@@ -472,7 +472,7 @@ func putAvatar(c *fiber.Ctx) error {
 	if aa, err = a.GetAPIAvatarWithPackages(); err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
-	return c.JSON(aa)
+	return clientJSON(c, config.ApiClientPayloadAvatar, aa)
 }
 
 // selectAvatar | PUT /avatars/:id/select
@@ -509,5 +509,5 @@ func selectAvatar(c *fiber.Ctx) error {
 
 	u.FallbackAvatarID = a.ID
 	u.FallbackAvatar = *a
-	return c.JSON(u.GetAPICurrentUser())
+	return clientJSON(c, config.ApiClientPayloadUser, u.GetAPICurrentUser())
 }
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ClientCompatibilityMiddleware parses the build of the client from its `X-Client-Version` header, and rejects builds
+// outside MinimumClientBuild & MaximumClientBuild. Requests without a (parsable) build are let through, as they are not
+// coming from the client.
+func ClientCompatibilityMiddleware(c *fiber.Ctx) error {
+	build := parseClientBuild(c.Get("X-Client-Version"))
+	c.Locals("clientBuild", build)
+	if build == 0 {
+		return c.Next()
+	}
+
+	minBuild, maxBuild := config.ApiConfiguration.MinimumClientBuild.Get(), config.ApiConfiguration.MaximumClientBuild.Get()
+	if (minBuild != 0 && build < minBuild) || (maxBuild != 0 && build > maxBuild) {
+		return c.Status(400).JSON(models.MakeErrorResponse(fmt.Sprintf("Client build %d is not supported by this server (supported builds: %s)", build, supportedClientBuilds(minBuild, maxBuild)), 400))
+	}
+
+	return c.Next()
+}
+
+// parseClientBuild returns the build number of an `X-Client-Version` header (e.g.: 2022.2.2p2-1207--Release), or 0 if it
+// cannot be found.
+func parseClientBuild(version string) int64 {
+	parts := strings.Split(version, "-")
+	if len(parts) < 2 {
+		return 0
+	}
+
+	build, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || build < 0 {
+		return 0
+	}
+
+	return build
+}
+
+// supportedClientBuilds describes the range of accepted builds for the rejection error.
+func supportedClientBuilds(minBuild, maxBuild int64) string {
+	switch {
+	case minBuild != 0 && maxBuild != 0:
+		return fmt.Sprintf("%d to %d", minBuild, maxBuild)
+	case minBuild != 0:
+		return fmt.Sprintf("%d and newer", minBuild)
+	default:
+		return fmt.Sprintf("%d and older", maxBuild)
+	}
+}
+
+// clientProfiles returns the profiles matching the build of the client making the request, in order.
+func clientProfiles(c *fiber.Ctx) []config.ApiClientProfile {
+	build, _ := c.Locals("clientBuild").(int64)
+
+	var profiles []config.ApiClientProfile
+	for _, p := range config.ApiConfiguration.ClientProfiles.Get() {
+		if p.Matches(build) {
+			profiles = append(profiles, p)
+		}
+	}
+
+	return profiles
+}
+
+// newClientConfigResponse returns the /config response with the overrides of the client's profiles applied.
+func newClientConfigResponse(c *fiber.Ctx) (*config.ApiConfigResponse, error) {
+	r := config.NewApiConfigResponse(&config.ApiConfiguration)
+	for _, p := range clientProfiles(c) {
+		if len(p.ConfigOverrides) == 0 {
+			continue
+		}
+
+		b, err := json.Marshal(p.ConfigOverrides)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(b, r); err != nil {
+			return nil, fmt.Errorf("client profile %s: %w", p.Name, err)
+		}
+	}
+
+	return r, nil
+}
+
+// clientJSON responds with v (a single payload, or a list of them) after applying the transforms the client's profiles
+// have for the payload.
+func clientJSON(c *fiber.Ctx, payload config.ApiClientPayload, v interface{}) error {
+	var transforms []config.ApiClientPayloadTransform
+	for _, p := range clientProfiles(c) {
+		if t, ok := p.Transforms[payload]; ok {
+			transforms = append(transforms, t)
+		}
+	}
+
+	if len(transforms) == 0 {
+		return c.JSON(v)
+	}
+
+	// Transforms operate on the generic JSON representation of the payload.
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var generic interface{}
+	if err = json.Unmarshal(b, &generic); err != nil {
+		return err
+	}
+
+	switch g := generic.(type) {
+	case map[string]interface{}:
+		applyClientTransforms(g, transforms)
+	case []interface{}:
+		for _, e := range g {
+			if m, ok := e.(map[string]interface{}); ok {
+				applyClientTransforms(m, transforms)
+			}
+		}
+	}
+
+	return c.JSON(generic)
+}
+
+// applyClientTransforms applies the transforms to the fields of a payload, in order.
+func applyClientTransforms(m map[string]interface{}, transforms []config.ApiClientPayloadTransform) {
+	for _, t := range transforms {
+		// Renames are applied in the order of their current name, so that chained renames (a to b, b to c) behave the
+		// same on every request.
+		var names = make([]string, 0, len(t.Rename))
+		for k := range t.Rename {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, from := range names {
+			to := t.Rename[from]
+			if v, ok := m[from]; ok {
+				delete(m, from)
+				m[to] = v
+			}
+		}
+
+		for _, k := range t.Omit {
+			delete(m, k)
+		}
+
+		for k, v := range t.Set {
+			m[k] = v
+		}
+	}
+}
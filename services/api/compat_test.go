@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"gitlab.com/george/shoya-go/config"
+	"reflect"
+	"testing"
+)
+
+func TestApplyClientTransforms(t *testing.T) {
+	tests := []struct {
+		name       string
+		payload    string
+		transforms []config.ApiClientPayloadTransform
+		want       string
+	}{
+		{
+			name:    "rename",
+			payload: `{"id": "avtr_1", "imageUrl": "a"}`,
+			transforms: []config.ApiClientPayloadTransform{
+				{Rename: map[string]string{"imageUrl": "thumbnailImageUrl", "missing": "ignored"}},
+			},
+			want: `{"id": "avtr_1", "thumbnailImageUrl": "a"}`,
+		},
+		{
+			name:       "omit",
+			payload:    `{"id": "avtr_1", "tags": []}`,
+			transforms: []config.ApiClientPayloadTransform{{Omit: []string{"tags", "missing"}}},
+			want:       `{"id": "avtr_1"}`,
+		},
+		{
+			name:    "set",
+			payload: `{"id": "avtr_1", "version": 1}`,
+			transforms: []config.ApiClientPayloadTransform{
+				{Set: map[string]json.RawMessage{"version": json.RawMessage(`2`), "featured": json.RawMessage(`false`)}},
+			},
+			want: `{"id": "avtr_1", "version": 2, "featured": false}`,
+		},
+		{
+			name:    "rename, omit & set in order",
+			payload: `{"id": "avtr_1", "name": "a", "tags": []}`,
+			transforms: []config.ApiClientPayloadTransform{{
+				Rename: map[string]string{"name": "displayName"},
+				Omit:   []string{"displayName"},
+				Set:    map[string]json.RawMessage{"tags": json.RawMessage(`["admin_approved"]`)},
+			}},
+			want: `{"id": "avtr_1", "tags": ["admin_approved"]}`,
+		},
+		{
+			name:    "chained renames",
+			payload: `{"id": "avtr_1", "a": 1, "b": 2}`,
+			transforms: []config.ApiClientPayloadTransform{
+				{Rename: map[string]string{"b": "c", "a": "b"}},
+			},
+			want: `{"id": "avtr_1", "c": 1}`,
+		},
+		{
+			name:    "later transforms see earlier ones",
+			payload: `{"id": "avtr_1", "a": 1}`,
+			transforms: []config.ApiClientPayloadTransform{
+				{Rename: map[string]string{"a": "b"}},
+				{Rename: map[string]string{"b": "c"}},
+			},
+			want: `{"id": "avtr_1", "c": 1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m, want map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.payload), &m); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			applyClientTransforms(m, tt.transforms)
+
+			// Values set by a transform are raw JSON; compare the payloads as they are sent.
+			b, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]interface{}
+			if err = json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("applyClientTransforms() = %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"strconv"
+)
+
+// configRoutes registers the admin routes of the config history. They are not grouped, as a /config group would apply
+// its middlewares to the public GET /config as well.
+func configRoutes(router *fiber.App) {
+	router.Get("/config/:key/history", ApiKeyMiddleware, AuthMiddleware, AdminMiddleware, getConfigHistory)
+	router.Post("/config/:key/rollback", ApiKeyMiddleware, AuthMiddleware, AdminMiddleware, postConfigRollback)
+}
+
+// getConfigHistory | GET /config/:key/history
+// Returns the recorded changes of a configuration value, oldest first. Secret values are hidden.
+func getConfigHistory(c *fiber.Ctx) error {
+	f, err := config.LookupApiConfigField(c.Params("key"))
+	if err != nil {
+		return configErrorResponse(c, err)
+	}
+
+	entries, err := config.GetApiConfigHistory(context.Background(), f)
+	if err != nil {
+		return configErrorResponse(c, err)
+	}
+
+	for i := range entries {
+		entries[i].Old, entries[i].New = f.Display(entries[i].Old), f.Display(entries[i].New)
+	}
+
+	return c.JSON(entries)
+}
+
+// postConfigRollback | POST /config/:key/rollback
+// Restores a configuration value as of ?version=, or undoes its latest change if no version is given. The rollback is
+// recorded as a change of its own, which is returned.
+func postConfigRollback(c *fiber.Ctx) error {
+	var version int64
+	var err error
+
+	if _v := c.Query("version"); _v != "" {
+		if version, err = strconv.ParseInt(_v, 10, 64); err != nil || version < 1 {
+			return c.Status(400).JSON(models.MakeErrorResponse("invalid version", 400))
+		}
+	}
+
+	f, err := config.LookupApiConfigField(c.Params("key"))
+	if err != nil {
+		return configErrorResponse(c, err)
+	}
+
+	e, err := config.RollbackApiConfigValue(context.Background(), f, version, c.Locals("user").(*models.User).Username)
+	if err != nil {
+		return configErrorResponse(c, err)
+	}
+
+	// The harvester picks the change up eventually; applying it right away keeps this instance consistent.
+	if err = f.Apply(e.New); err != nil {
+		return configErrorResponse(c, err)
+	}
+
+	e.Old, e.New = f.Display(e.Old), f.Display(e.New)
+	return c.JSON(e)
+}
+
+// configErrorResponse responds with the status code matching an error returned by the config history.
+func configErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, config.ErrUnknownConfigKey), errors.Is(err, config.ErrNoConfigHistory), errors.Is(err, config.ErrConfigVersionNotFound):
+		return c.Status(404).JSON(models.MakeErrorResponse(err.Error(), 404))
+	case errors.Is(err, config.ErrConfigAlreadyAtVersion):
+		return c.Status(409).JSON(models.MakeErrorResponse(err.Error(), 409))
+	default:
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+}
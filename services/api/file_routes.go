@@ -8,7 +8,9 @@ import (
 	"gitlab.com/george/shoya-go/config"
 	pb "gitlab.com/george/shoya-go/gen/v1/proto"
 	"gitlab.com/george/shoya-go/models"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -16,7 +18,7 @@ import (
 
 func fileRoutes(router *fiber.App) {
 	image := router.Group("/image", filesServiceHealthMiddleware)
-	image.Get("/:id/:version/:size", getFileVersion) // TODO: I guess we're making that cancelled thumbnail service at some point
+	image.Get("/:id/:version/:size", getImage)
 
 	file := router.Group("/file", filesServiceHealthMiddleware)
 	file.Post("/", ApiKeyMiddleware, AuthMiddleware, createFile)
@@ -43,6 +45,15 @@ func createFile(c *fiber.Ctx) error {
 		return c.Status(500).JSON(models.MakeErrorResponse("failed to parse request body", 500))
 	}
 
+	usage, err := models.GetStorageUsage(u)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if err = usage.CanCreateFile(); err != nil {
+		return c.Status(403).JSON(models.MakeErrorResponse(err.Error(), 403))
+	}
+
 	f = models.NewFile(r.Name, u.ID, r.MimeType, r.Extension)
 	return c.JSON(f.GetAPIFile())
 }
@@ -130,16 +141,36 @@ func postFile(c *fiber.Ctx) error {
 		return c.Status(500).JSON(models.MakeErrorResponse("file or signature md5 invalid", 500))
 	}
 
+	if r.FileSizeInBytes < 0 || r.DeltaSizeInBytes < 0 || r.SignatureSizeInBytes < 0 {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid file size", 400))
+	}
+
+	if err = f.CheckUploadSize(int64(r.FileSizeInBytes)); err == nil {
+		err = f.CheckUploadSize(int64(r.DeltaSizeInBytes))
+	}
+	if err != nil {
+		return c.Status(413).JSON(models.MakeErrorResponse(err.Error(), 413))
+	}
+
+	usage, err := models.GetStorageUsageByUserId(f.OwnerID)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if err = usage.CanStore(int64(r.FileSizeInBytes + r.DeltaSizeInBytes + r.SignatureSizeInBytes)); err != nil {
+		return c.Status(403).JSON(models.MakeErrorResponse(err.Error(), 403))
+	}
+
 	if r.FileMd5 != "" && r.FileSizeInBytes != 0 {
 		fileDescriptor.Status = models.FileUploadStatusWaiting
-		fileDescriptor.Category = models.FileUploadCategorySimple
+		fileDescriptor.Category = uploadCategoryForSize(r.FileSizeInBytes)
 		fileDescriptor.Md5 = r.FileMd5
 		fileDescriptor.SizeInBytes = r.FileSizeInBytes
 	}
 
 	if r.DeltaMd5 != "" && r.DeltaSizeInBytes != 0 {
 		deltaDescriptor.Status = models.FileUploadStatusWaiting
-		deltaDescriptor.Category = models.FileUploadCategorySimple
+		deltaDescriptor.Category = uploadCategoryForSize(r.DeltaSizeInBytes)
 		deltaDescriptor.Md5 = r.DeltaMd5
 		deltaDescriptor.SizeInBytes = r.DeltaSizeInBytes
 	}
@@ -183,13 +214,56 @@ func postFile(c *fiber.Ctx) error {
 // Deletes a file record.
 func deleteFile(c *fiber.Ctx) error {
 	var f = c.Locals("file").(*models.File)
-	tx := config.DB.Unscoped().Preload(clause.Associations).
-		Preload("Versions.FileDescriptor").
-		Preload("Versions.DeltaDescriptor").
-		Preload("Versions.SignatureDescriptor").
-		Delete(&f)
-	if tx.Error != nil {
-		return c.Status(500).JSON(models.MakeErrorResponse(tx.Error.Error(), 500))
+
+	var descriptorIds []string
+	var objects []string
+
+	tx := config.DB.Begin()
+	for _, v := range f.Versions {
+		for _, fd := range []models.FileDescriptor{v.FileDescriptor, v.DeltaDescriptor, v.SignatureDescriptor} {
+			if fd.ID == "" {
+				continue
+			}
+			descriptorIds = append(descriptorIds, fd.ID)
+
+			if fd.UploadId != "" && fd.Status != models.FileUploadStatusComplete {
+				abortMultipartUpload(&fd)
+			}
+
+			// Incomplete descriptors are left to the garbage collection of the files service, which also picks up objects
+			// that fail to be deleted here.
+			if fd.Status == models.FileUploadStatusComplete {
+				last, err := models.ReleaseFileObject(tx, &fd)
+				if err != nil {
+					tx.Rollback()
+					return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+				}
+
+				if last {
+					objects = append(objects, fd.GetObjectName())
+				}
+			}
+		}
+	}
+
+	if err := tx.Unscoped().Delete(&f).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if len(descriptorIds) != 0 {
+		if err := tx.Unscoped().Where("id IN ?", descriptorIds).Delete(&models.FileDescriptor{}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	for _, o := range objects {
+		deleteObject(o)
 	}
 
 	return c.JSON(fiber.Map{"ok": true})
@@ -201,7 +275,6 @@ func getFileVersion(c *fiber.Ctx) error {
 	var id = c.Params("id")
 	var ver, err = strconv.Atoi(c.Params("version"))
 	var v *models.FileVersion
-	var r *pb.GetFileResponse
 	if err != nil {
 		return c.Status(400).JSON(models.MakeErrorResponse("invalid file version", 400))
 	}
@@ -217,14 +290,12 @@ func getFileVersion(c *fiber.Ctx) error {
 	v = f.GetVersion(ver)
 	if v.FileDescriptor.Status == models.FileUploadStatusComplete {
 		if v.FileDescriptor.Status == models.FileUploadStatusComplete {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			defer cancel()
-			r, err = FilesService.GetFile(ctx, &pb.GetFileRequest{Name: &v.FileDescriptor.FileName})
+			u, err := getFileDownloadUrl(f, v.FileDescriptor.GetObjectName())
 			if err != nil {
 				return c.Status(500).JSON(models.MakeErrorResponse("failed to generate file url", 500))
 			}
 
-			return c.Redirect(r.GetUrl())
+			return c.Redirect(u)
 		}
 	}
 
@@ -236,6 +307,82 @@ func getFileVersion(c *fiber.Ctx) error {
 	})
 }
 
+// getImage | GET /image/:id/:version/:size
+// Returns a redirect to the variant of the image for that version that is resized to the size (width), which is
+// generated on first request. The format of the variant can be picked with ?format=png|jpeg, and defaults to the one of
+// the image.
+func getImage(c *fiber.Ctx) error {
+	var id = c.Params("id")
+	var ver, err = strconv.Atoi(c.Params("version"))
+	var size int
+	var v *models.FileVersion
+	if err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid file version", 400))
+	}
+
+	if size, err = strconv.Atoi(c.Params("size")); err != nil || size <= 0 {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid image size", 400))
+	}
+
+	var f *models.File
+	if f, err = models.GetFile(id); err != nil {
+		if err == models.ErrFileNotFound {
+			return c.Status(404).JSON(models.MakeErrorResponse(fmt.Sprintf("file %s not found", id), 404))
+		}
+		return c.JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	format := imageFormatForMimeType(f.MimeType)
+	if format == "" {
+		return c.Status(400).JSON(models.MakeErrorResponse("file is not an image", 400))
+	}
+
+	if c.Query("format") != "" {
+		if format = c.Query("format"); format != "png" && format != "jpeg" {
+			return c.Status(400).JSON(models.MakeErrorResponse("invalid image format", 400))
+		}
+	}
+
+	v = f.GetVersion(ver)
+	if v.FileDescriptor.Status != models.FileUploadStatusComplete {
+		return c.Status(404).JSON(models.MakeErrorResponse(fmt.Sprintf("file %s has no complete version %d", id, ver), 404))
+	}
+
+	u, err := getImageDownloadUrl(f, v.FileDescriptor.GetObjectName(), int32(models.ImageVariantWidth(size)), format)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse("failed to generate image url", 500))
+	}
+
+	return c.Redirect(u)
+}
+
+// imageFormatForMimeType returns the image format that matches the mime type, or an empty string if variants can not be
+// generated for it.
+func imageFormatForMimeType(mimeType string) string {
+	switch mimeType {
+	case "image/png":
+		return "png"
+	case "image/jpeg", "image/jpg":
+		return "jpeg"
+	default:
+		return ""
+	}
+}
+
+// generateImageVariants generates the variants of an image ahead of them being requested.
+func generateImageVariants(name, format string) {
+	for _, w := range models.ImageVariantWidths {
+		width := int32(w)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_, err := FilesService.GetImage(ctx, &pb.GetImageRequest{Name: &name, Width: &width, Format: &format})
+		cancel()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+}
+
 // getFileVersionDescriptor | GET /file/:id/:version/:descriptor
 // Returns a redirect to the specific file descriptor for that version.
 // Valid file descriptors: file, delta, signature
@@ -244,7 +391,6 @@ func getFileVersionDescriptor(c *fiber.Ctx) error {
 	var id = c.Params("id")
 	var descriptor = c.Params("descriptor")
 	var ver, err = strconv.Atoi(c.Params("version"))
-	var r *pb.GetFileResponse
 	if err != nil {
 		return c.Status(400).JSON(models.MakeErrorResponse("invalid file version", 400))
 	}
@@ -258,36 +404,30 @@ func getFileVersionDescriptor(c *fiber.Ctx) error {
 	switch models.FileDescriptorType(descriptor) {
 	case models.FileDescriptorTypeFile:
 		if v.FileDescriptor.Status == models.FileUploadStatusComplete {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			defer cancel()
-			r, err = FilesService.GetFile(ctx, &pb.GetFileRequest{Name: &v.FileDescriptor.FileName})
+			u, err := getFileDownloadUrl(f, v.FileDescriptor.GetObjectName())
 			if err != nil {
 				return c.Status(500).JSON(models.MakeErrorResponse("failed to generate file url", 500))
 			}
 
-			return c.Redirect(r.GetUrl())
+			return c.Redirect(u)
 		}
 	case models.FileDescriptorTypeDelta:
 		if v.DeltaDescriptor.Status == models.FileUploadStatusComplete {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			defer cancel()
-			r, err = FilesService.GetFile(ctx, &pb.GetFileRequest{Name: &v.DeltaDescriptor.FileName})
+			u, err := getFileDownloadUrl(f, v.DeltaDescriptor.GetObjectName())
 			if err != nil {
 				return c.Status(500).JSON(models.MakeErrorResponse("failed to generate file url", 500))
 			}
 
-			return c.Redirect(r.GetUrl())
+			return c.Redirect(u)
 		}
 	case models.FileDescriptorTypeSignature:
 		if v.SignatureDescriptor.Status == models.FileUploadStatusComplete {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			defer cancel()
-			r, err = FilesService.GetFile(ctx, &pb.GetFileRequest{Name: &v.SignatureDescriptor.FileName})
+			u, err := getFileDownloadUrl(f, v.SignatureDescriptor.GetObjectName())
 			if err != nil {
 				return c.Status(500).JSON(models.MakeErrorResponse("failed to generate file url", 500))
 			}
 
-			return c.Redirect(r.GetUrl())
+			return c.Redirect(u)
 		}
 	}
 
@@ -324,12 +464,12 @@ func getFileVersionDescriptorStatus(c *fiber.Ctx) error {
 
 // putFileVersionDescriptorStart | PUT /file/:id/:version/:descriptor/start
 // Starts the upload of a file version's descriptor.
+// For multipart descriptors, this returns the upload url of the part specified in the `partNumber` query parameter.
 func putFileVersionDescriptorStart(c *fiber.Ctx) error {
 	var f = c.Locals("file").(*models.File)
 	var v int
 	var ver *models.FileVersion
-	var fileName string
-	var fileMd5 string
+	var fd *models.FileDescriptor
 	var err error
 
 	if v, err = strconv.Atoi(c.Params("version")); v < 0 || err != nil {
@@ -337,32 +477,130 @@ func putFileVersionDescriptorStart(c *fiber.Ctx) error {
 	}
 	ver = f.GetVersion(v)
 
-	switch models.FileDescriptorType(c.Params("descriptor")) {
-	case models.FileDescriptorTypeFile:
-		if ver.FileDescriptor.Status == models.FileUploadStatusComplete {
-			return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
+	if fd = ver.GetDescriptor(models.FileDescriptorType(c.Params("descriptor"))); fd == nil {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid descriptor", 400))
+	}
+
+	if fd.Status == models.FileUploadStatusComplete {
+		return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
+	}
+
+	// Only descriptors announced with a size are accounted for in the storage usage, so only those may be uploaded.
+	if fd.Status != models.FileUploadStatusWaiting || fd.SizeInBytes <= 0 {
+		return c.Status(400).JSON(models.MakeErrorResponse("descriptor is not waiting for an upload", 400))
+	}
+
+	// The limits are checked again, as they may have been lowered since the version was created.
+	if models.FileDescriptorType(c.Params("descriptor")) != models.FileDescriptorTypeSignature {
+		if err = f.CheckUploadSize(int64(fd.SizeInBytes)); err != nil {
+			return c.Status(413).JSON(models.MakeErrorResponse(err.Error(), 413))
 		}
-		fileName = ver.FileDescriptor.FileName
-		fileMd5 = ver.FileDescriptor.Md5
-	case models.FileDescriptorTypeDelta:
-		if ver.DeltaDescriptor.Status == models.FileUploadStatusComplete {
-			return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
+	}
+
+	usage, err := models.GetStorageUsageByUserId(f.OwnerID)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	// The descriptor itself is already accounted for in the usage.
+	if err = usage.CanStore(0); err != nil {
+		return c.Status(403).JSON(models.MakeErrorResponse(err.Error(), 403))
+	}
+
+	if fd.Category == models.FileUploadCategoryMultipart {
+		return startMultipartUploadPart(c, f, fd)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, err := FilesService.CreateFile(ctx, &pb.CreateFileRequest{Name: &fd.FileName, Md5: &fd.Md5, ContentType: &f.MimeType})
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	// Multipart descriptors are only deduplicated on finish, as clients start every part & would fail on the second one.
+	var o *models.FileObject
+	if o, err = models.FindOwnedFileObject(f.OwnerID, fd.Md5, fd.SizeInBytes); err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if o != nil {
+		return linkExistingFileObject(c, ver, fd, o, r.GetUrl())
+	}
+
+	return c.JSON(fiber.Map{
+		"url": r.GetUrl(),
+	})
+}
+
+// linkExistingFileObject completes the descriptor without an upload, by pointing it at an object with the same contents
+// that is already present in storage. The upload url is still returned, as clients unaware of alreadyPresent upload &
+// finish the descriptor regardless; whatever they upload is deleted on finish.
+func linkExistingFileObject(c *fiber.Ctx, ver *models.FileVersion, fd *models.FileDescriptor, o *models.FileObject, url string) error {
+	tx := config.DB.Begin()
+	if err := models.AcquireFileObject(tx, o.Name); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if err := tx.Model(fd).Updates(map[string]interface{}{"status": models.FileUploadStatusComplete, "object_name": o.Name}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
+	}
+	fd.Status = models.FileUploadStatusComplete
+	fd.ObjectName = o.Name
+
+	if err := updateFileVersionStatus(tx, ver); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return c.JSON(fiber.Map{
+		"url":            url,
+		"alreadyPresent": true,
+	})
+}
+
+// startMultipartUploadPart returns the upload url for a part of a multipart descriptor, creating the multipart upload
+// on the first call.
+func startMultipartUploadPart(c *fiber.Ctx, f *models.File, fd *models.FileDescriptor) error {
+	partNumber, err := strconv.Atoi(c.Query("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > models.FileMaxUploadParts {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid part number", 400))
+	}
+
+	if fd.UploadId == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		mu, err := FilesService.CreateMultipartUpload(ctx, &pb.CreateMultipartUploadRequest{Name: &fd.FileName, ContentType: &f.MimeType})
+		if err != nil {
+			return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 		}
-		fileName = ver.DeltaDescriptor.FileName
-		fileMd5 = ver.DeltaDescriptor.Md5
-	case models.FileDescriptorTypeSignature:
-		if ver.SignatureDescriptor.Status == models.FileUploadStatusComplete {
-			return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
+
+		// Only store our upload id if no other request has beaten us to it; otherwise, use theirs and abort ours.
+		tx := config.DB.Model(&models.FileDescriptor{}).Where("id = ? AND upload_id = ''", fd.ID).Update("upload_id", mu.GetUploadId())
+		if tx.Error != nil {
+			return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
+		}
+
+		if tx.RowsAffected == 0 {
+			abortMultipartUpload(&models.FileDescriptor{FileName: fd.FileName, UploadId: mu.GetUploadId()})
+			if err = config.DB.Where("id = ?", fd.ID).First(fd).Error; err != nil {
+				return c.Status(500).JSON(models.MakeErrorResponse("error getting file descriptor", 500))
+			}
+		} else {
+			fd.UploadId = mu.GetUploadId()
 		}
-		fileName = ver.SignatureDescriptor.FileName
-		fileMd5 = ver.SignatureDescriptor.Md5
-	default:
-		return c.Status(400).JSON(models.MakeErrorResponse("invalid descriptor", 400))
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	r, err := FilesService.CreateFile(ctx, &pb.CreateFileRequest{Name: &fileName, Md5: &fileMd5, ContentType: &f.MimeType})
+	pn := int32(partNumber)
+	r, err := FilesService.GetPartUploadUrl(ctx, &pb.GetPartUploadUrlRequest{Name: &fd.FileName, UploadId: &fd.UploadId, PartNumber: &pn})
 	if err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
@@ -372,10 +610,97 @@ func putFileVersionDescriptorStart(c *fiber.Ctx) error {
 	})
 }
 
+// deleteObject deletes an object from storage.
+func deleteObject(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := FilesService.DeleteFile(ctx, &pb.DeleteFileRequest{Name: &name})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	invalidateCachedUrls(name)
+}
+
+// abortMultipartUpload aborts the multipart upload of a descriptor, discarding any parts uploaded so far.
+func abortMultipartUpload(fd *models.FileDescriptor) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := FilesService.AbortMultipartUpload(ctx, &pb.AbortMultipartUploadRequest{Name: &fd.FileName, UploadId: &fd.UploadId})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// verifyUploadedDescriptor checks that the object of a descriptor exists in storage, fits in the limits of the file & the
+// quota of its owner, and that its size & MD5 match what the client announced when creating the file version. The MD5 is
+// computed over the whole object by the files service, as the ETags of multipart uploads are not hashes of the contents.
+// The SHA-256 of the object is returned if it matches, and a non-empty reason if it does not.
+func verifyUploadedDescriptor(f *models.File, fd *models.FileDescriptor) (string, string, error) {
+	if fd.SizeInBytes == 0 || fd.Md5 == "" {
+		return "", "no size or md5 was announced", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st, err := FilesService.StatFile(ctx, &pb.StatFileRequest{Name: &fd.FileName})
+	if err != nil {
+		return "", "", err
+	}
+
+	if !st.GetExists() {
+		return "", "object not found in storage", nil
+	}
+
+	// The limits are checked against the size that was actually stored, rather than the announced one.
+	if fd.Type != models.FileDescriptorTypeSignature {
+		if err = f.CheckUploadSize(st.GetSize()); err != nil {
+			return "", err.Error(), nil
+		}
+	}
+
+	usage, err := models.GetStorageUsageByUserId(f.OwnerID)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The announced size is already accounted for in the usage.
+	if err = usage.CanStore(st.GetSize() - int64(fd.SizeInBytes)); err != nil {
+		return "", err.Error(), nil
+	}
+
+	if st.GetSize() != int64(fd.SizeInBytes) {
+		return "", fmt.Sprintf("size mismatch (expected %d bytes, got %d bytes)", fd.SizeInBytes, st.GetSize()), nil
+	}
+
+	hashCtx, hashCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer hashCancel()
+	h, err := FilesService.HashFile(hashCtx, &pb.HashFileRequest{Name: &fd.FileName})
+	if err != nil {
+		return "", "", err
+	}
+
+	if !fd.MatchesMd5(h.GetMd5()) {
+		return "", "md5 mismatch", nil
+	}
+
+	return h.GetSha256(), "", nil
+}
+
+// uploadCategoryForSize returns the upload category a descriptor of the provided size should be uploaded with.
+func uploadCategoryForSize(size int) models.FileUploadCategory {
+	if size > models.FileMultipartUploadThreshold {
+		return models.FileUploadCategoryMultipart
+	}
+
+	return models.FileUploadCategorySimple
+}
+
 // putFileVersionDescriptorFinish | PUT /file/:id/:version/:descriptor/finish
 // Marks the upload of a file version's descriptor as finished.
 func putFileVersionDescriptorFinish(c *fiber.Ctx) error {
 	var f = c.Locals("file").(*models.File)
+	var r FinishFileUploadRequest
 	var v int
 	var ver *models.FileVersion
 	var fd *models.FileDescriptor
@@ -386,58 +711,115 @@ func putFileVersionDescriptorFinish(c *fiber.Ctx) error {
 	}
 	ver = f.GetVersion(v)
 
-	switch models.FileDescriptorType(c.Params("descriptor")) {
-	case models.FileDescriptorTypeFile:
-		if ver.FileDescriptor.Status == models.FileUploadStatusComplete {
-			return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
-		}
-		tx := config.DB.Where("id = ?", ver.FileDescriptorID).First(&fd)
-		if tx.Error != nil {
-			return c.Status(500).JSON(models.MakeErrorResponse("error getting file descriptor", 500))
-		}
-		ver.FileDescriptor.Status = models.FileUploadStatusComplete
-	case models.FileDescriptorTypeDelta:
-		if ver.DeltaDescriptor.Status == models.FileUploadStatusComplete {
-			return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
-		}
-		tx := config.DB.Where("id = ?", ver.DeltaDescriptorID).First(&fd)
-		if tx.Error != nil {
-			return c.Status(500).JSON(models.MakeErrorResponse("error getting file descriptor", 500))
+	var vfd *models.FileDescriptor
+	if vfd = ver.GetDescriptor(models.FileDescriptorType(c.Params("descriptor"))); vfd == nil {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid descriptor", 400))
+	}
+
+	if vfd.Status == models.FileUploadStatusComplete {
+		// Descriptors linked to an existing object on start are already complete, but clients still finish them; the
+		// copy they may have uploaded regardless is not referenced by anything.
+		if vfd.GetObjectName() != vfd.FileName {
+			deleteObject(vfd.FileName)
+			return c.JSON(ver.GetAPIFileVersion())
 		}
-		ver.DeltaDescriptor.Status = models.FileUploadStatusComplete
-	case models.FileDescriptorTypeSignature:
-		if ver.SignatureDescriptor.Status == models.FileUploadStatusComplete {
-			return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
+		return c.Status(400).JSON(models.MakeErrorResponse("already completed", 400))
+	}
+
+	if vfd.Status != models.FileUploadStatusWaiting {
+		return c.Status(400).JSON(models.MakeErrorResponse("descriptor is not waiting for an upload", 400))
+	}
+
+	tx := config.DB.Where("id = ?", vfd.ID).First(&fd)
+	if tx.Error != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse("error getting file descriptor", 500))
+	}
+
+	var changes = map[string]interface{}{}
+	if fd.Category == models.FileUploadCategoryMultipart {
+		if err = c.BodyParser(&r); err != nil || len(r.ETags) == 0 || fd.UploadId == "" {
+			return c.Status(400).JSON(models.MakeErrorResponse("multipart upload requires etags", 400))
 		}
-		tx := config.DB.Where("id = ?", ver.SignatureDescriptorID).First(&fd)
-		if tx.Error != nil {
-			return c.Status(500).JSON(models.MakeErrorResponse("error getting file descriptor", 500))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, err = FilesService.CompleteMultipartUpload(ctx, &pb.CompleteMultipartUploadRequest{Name: &fd.FileName, UploadId: &fd.UploadId, Etags: r.ETags})
+		if err != nil {
+			return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 		}
-		ver.SignatureDescriptor.Status = models.FileUploadStatusComplete
-	default:
-		return c.Status(400).JSON(models.MakeErrorResponse("invalid descriptor", 400))
+
+		fd.PartETags = r.ETags
+		changes["part_e_tags"] = fd.PartETags
 	}
 
-	fd.Status = models.FileUploadStatusComplete
-	if config.DB.Omit(clause.Associations).Updates(fd).Error != nil {
-		return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
+	sha256, reason, err := verifyUploadedDescriptor(f, fd)
+	if err != nil {
+		log.Printf("error verifying the upload of %s: %v", fd.FileName, err)
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
 
-	if ver.FileDescriptor.Status == models.FileUploadStatusComplete && ver.SignatureDescriptor.Status == models.FileUploadStatusComplete {
-		ver.Status = models.FileUploadStatusComplete
-		if config.DB.Omit(clause.Associations).Updates(ver).Error != nil {
-			return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
-		}
-	} else if ver.DeltaDescriptor.Status == models.FileUploadStatusComplete && ver.SignatureDescriptor.Status == models.FileUploadStatusComplete {
-		ver.Status = models.FileUploadStatusComplete
-		if config.DB.Omit(clause.Associations).Updates(ver).Error != nil {
+	if reason != "" {
+		changes["status"] = models.FileUploadStatusError
+		changes["error_reason"] = reason
+		if config.DB.Model(fd).Updates(changes).Error != nil {
 			return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
 		}
+
+		return c.Status(400).JSON(models.MakeErrorResponse(fmt.Sprintf("upload verification failed: %s", reason), 400))
+	}
+
+	changes["status"] = models.FileUploadStatusComplete
+	changes["error_reason"] = ""
+
+	tx = config.DB.Begin()
+	if tx.Model(fd).Updates(changes).Error != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
+	}
+
+	object, err := models.LinkFileObject(tx, fd, sha256)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+	vfd.Status = models.FileUploadStatusComplete
+	vfd.ObjectName = object
+
+	if updateFileVersionStatus(tx, ver) != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(models.MakeErrorResponse("could not update database object", 500))
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	// The contents were already present in storage, so the uploaded copy is no longer needed.
+	if object != fd.FileName {
+		deleteObject(fd.FileName)
+	}
+
+	if vfd.Type == models.FileDescriptorTypeFile && imageFormatForMimeType(f.MimeType) != "" {
+		go generateImageVariants(object, imageFormatForMimeType(f.MimeType))
 	}
 
 	return c.JSON(ver.GetAPIFileVersion())
 }
 
+// updateFileVersionStatus marks the version as complete once its file (or delta) & signature descriptors are.
+func updateFileVersionStatus(tx *gorm.DB, ver *models.FileVersion) error {
+	if ver.SignatureDescriptor.Status != models.FileUploadStatusComplete {
+		return nil
+	}
+
+	if ver.FileDescriptor.Status != models.FileUploadStatusComplete && ver.DeltaDescriptor.Status != models.FileUploadStatusComplete {
+		return nil
+	}
+
+	ver.Status = models.FileUploadStatusComplete
+	return tx.Omit(clause.Associations).Updates(ver).Error
+}
+
 func IsFileOwnerMiddleware(c *fiber.Ctx) error {
 	var u = c.Locals("user").(*models.User)
 	var fid = c.Params("id")
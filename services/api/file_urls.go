@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"gitlab.com/george/shoya-go/config"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"gitlab.com/george/shoya-go/models"
+	"strings"
+	"time"
+)
+
+// imageFormats are the formats image variants can be requested in.
+var imageFormats = []string{"png", "jpeg"}
+
+// fileUrlCacheKey returns the key the download url of the object is cached under.
+func fileUrlCacheKey(name string) string {
+	return "files:url:" + name
+}
+
+// imageUrlCacheKey returns the key the download url of the variant of the image is cached under.
+func imageUrlCacheKey(name string, width int32, format string) string {
+	return fmt.Sprintf("files:url:%s:%d:%s", name, width, format)
+}
+
+// getFileDownloadUrl returns the url the object of the file can be downloaded from. Public files are served from
+// FilesPublicBaseUrl if it is set. Either url is cached for up to FilesUrlCacheTtlSeconds, so that whether the file is
+// public isn't looked up on every request.
+func getFileDownloadUrl(f *models.File, name string) (string, error) {
+	key := fileUrlCacheKey(name)
+	if u := getCachedUrl(key); u != "" {
+		return u, nil
+	}
+
+	if u := publicObjectUrl(f, name); u != "" {
+		cacheUrl(key, u, 0)
+		return u, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, err := FilesService.GetFile(ctx, &pb.GetFileRequest{Name: &name})
+	if err != nil {
+		return "", err
+	}
+
+	cacheUrl(key, r.GetUrl(), r.GetExpiresAt())
+	return r.GetUrl(), nil
+}
+
+// getImageDownloadUrl returns the url the variant of the image can be downloaded from, generating the variant if it
+// does not exist yet. Like getFileDownloadUrl, public images are served from FilesPublicBaseUrl if it is set.
+func getImageDownloadUrl(f *models.File, name string, width int32, format string) (string, error) {
+	key := imageUrlCacheKey(name, width, format)
+	if u := getCachedUrl(key); u != "" {
+		return u, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	r, err := FilesService.GetImage(ctx, &pb.GetImageRequest{Name: &name, Width: &width, Format: &format})
+	if err != nil {
+		return "", err
+	}
+
+	// The variant has to exist before it can be served publicly, so the files service is asked for it either way.
+	if u := publicObjectUrl(f, r.GetName()); u != "" && r.GetName() != "" {
+		cacheUrl(key, u, 0)
+		return u, nil
+	}
+
+	cacheUrl(key, r.GetUrl(), r.GetExpiresAt())
+	return r.GetUrl(), nil
+}
+
+// publicObjectUrl returns the public url of the object if FilesPublicBaseUrl is set and the file is public, or an empty
+// string otherwise.
+func publicObjectUrl(f *models.File, name string) string {
+	base := config.ApiConfiguration.FilesPublicBaseUrl.Get()
+	if base == "" {
+		return ""
+	}
+
+	public, err := f.IsPublic()
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+
+	if !public {
+		return ""
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + name
+}
+
+// getCachedUrl returns the url cached under the key, or an empty string if there is none.
+func getCachedUrl(key string) string {
+	if config.ApiConfiguration.FilesUrlCacheTtlSeconds.Get() <= 0 {
+		return ""
+	}
+
+	u, err := config.RedisClient.Get(context.Background(), key).Result()
+	if err != nil {
+		if err != redis.Nil {
+			fmt.Println(err)
+		}
+		return ""
+	}
+
+	return u
+}
+
+// cacheUrl caches the url under the key for FilesUrlCacheTtlSeconds. If the url expires (expiresAt is non-zero), it is
+// never cached for longer than 90% of its remaining lifetime, so that clients are not handed urls about to expire.
+func cacheUrl(key, u string, expiresAt int64) {
+	ttl := time.Duration(config.ApiConfiguration.FilesUrlCacheTtlSeconds.Get()) * time.Second
+	if expiresAt != 0 {
+		if remaining := time.Until(time.Unix(expiresAt, 0)) * 9 / 10; remaining < ttl {
+			ttl = remaining
+		}
+	}
+
+	if ttl < time.Second {
+		return
+	}
+
+	if err := config.RedisClient.Set(context.Background(), key, u, ttl).Err(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// invalidateCachedUrls removes the cached download urls of the object & its image variants.
+func invalidateCachedUrls(name string) {
+	keys := []string{fileUrlCacheKey(name)}
+	for _, w := range models.ImageVariantWidths {
+		for _, format := range imageFormats {
+			keys = append(keys, imageUrlCacheKey(name, int32(w), format))
+		}
+	}
+
+	if err := config.RedisClient.Del(context.Background(), keys...).Err(); err != nil {
+		fmt.Println(err)
+	}
+}
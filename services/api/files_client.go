@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gitlab.com/george/shoya-go/config"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"os"
+)
+
+// tokenCredentials attaches the auth token of the files service to every call as a bearer token.
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (t tokenCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+// filesDialOptions returns the options the files client is dialed with, based on the TLS & authentication
+// configuration.
+func filesDialOptions(c config.GrpcClientSvcConfig) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+
+	if c.Tls.Enabled {
+		t, err := filesTlsConfig(c.Tls)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(t)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	if c.AuthToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: c.AuthToken, secure: c.Tls.Enabled}))
+	}
+
+	return opts, nil
+}
+
+// filesTlsConfig builds the TLS configuration used to connect to the files service, loading the client certificate if
+// one is configured.
+func filesTlsConfig(c config.GrpcClientTlsSvcConfig) (*tls.Config, error) {
+	t := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.CaFile != "" {
+		pem, err := os.ReadFile(c.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls ca: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("error reading tls ca: no certificates found")
+		}
+
+		t.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tls client certificate: %w", err)
+		}
+
+		t.Certificates = []tls.Certificate{cert}
+	}
+
+	return t, nil
+}
+
+// DialFilesService connects to the files service at the endpoint, using the TLS & authentication configuration of the
+// client.
+func DialFilesService(endpoint string, c config.GrpcClientSvcConfig) (pb.FileClient, error) {
+	opts, err := filesDialOptions(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure files client: %w", err)
+	}
+
+	conn, err := grpc.Dial(endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pb.NewFileClient(conn), nil
+}
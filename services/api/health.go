@@ -3,8 +3,10 @@ package api
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"gitlab.com/george/shoya-go/config"
 	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"strings"
 	"time"
 )
 
@@ -16,8 +18,17 @@ type HealthStatus struct {
 }
 
 type HealthStatusDetails struct {
-	Ok    bool   `json:"ok"`
-	Error string `json:"error,omitempty"`
+	Ok         bool                     `json:"ok"`
+	Error      string                   `json:"error,omitempty"`
+	Components []HealthComponentDetails `json:"components,omitempty"`
+}
+
+// HealthComponentDetails is the status of a single component of a service (e.g.: the storage of the files service).
+type HealthComponentDetails struct {
+	Name      string `json:"name"`
+	Ok        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt int64  `json:"checkedAt"`
 }
 
 var healthStatus HealthStatus
@@ -80,24 +91,57 @@ func postgresHealthCheck() {
 
 func filesHealthCheck() {
 	for {
-		ok, err := filesHealthCheckInternal()
-		if ok == false || err != nil {
+		r, err := filesHealthCheckInternal()
+		if err != nil {
 			healthStatus.Files.Ok = false
 			healthStatus.Files.Error = "ping failed with error: " + err.Error()
-		} else if !healthStatus.Files.Ok {
-			healthStatus.Files.Ok = true
-			healthStatus.Files.Error = ""
+			healthStatus.Files.Components = nil
+		} else {
+			healthStatus.Files.Components = filesHealthComponents(r)
+			if !r.GetOk() {
+				healthStatus.Files.Ok = false
+				healthStatus.Files.Error = "unhealthy components: " + filesUnhealthyComponents(r)
+			} else if !healthStatus.Files.Ok {
+				healthStatus.Files.Ok = true
+				healthStatus.Files.Error = ""
+			}
 		}
 		time.Sleep(healthCheckFrequency)
 	}
 }
-func filesHealthCheckInternal() (bool, error) {
+func filesHealthCheckInternal() (*pb.HealthCheckResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
-	r, err := FilesService.HealthCheck(ctx, &pb.HealthCheckRequest{})
-	if err != nil {
-		return false, err
+	return FilesService.HealthCheck(ctx, &pb.HealthCheckRequest{})
+}
+
+// filesHealthComponents converts the component statuses reported by the files service.
+func filesHealthComponents(r *pb.HealthCheckResponse) []HealthComponentDetails {
+	var components []HealthComponentDetails
+	for _, c := range r.GetComponents() {
+		components = append(components, HealthComponentDetails{
+			Name:      c.GetName(),
+			Ok:        c.GetOk(),
+			Error:     c.GetError(),
+			CheckedAt: c.GetCheckedAt(),
+		})
+	}
+
+	return components
+}
+
+// filesUnhealthyComponents lists the components the files service reported as unhealthy, along with their errors.
+func filesUnhealthyComponents(r *pb.HealthCheckResponse) string {
+	var unhealthy []string
+	for _, c := range r.GetComponents() {
+		if !c.GetOk() {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", c.GetName(), c.GetError()))
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		return "unknown"
 	}
 
-	return r.GetOk(), nil
+	return strings.Join(unhealthy, ", ")
 }
@@ -9,15 +9,75 @@ import (
 
 func instanceRoutes(router *fiber.App) {
 	instances := router.Group("/instances", ApiKeyMiddleware, AuthMiddleware)
+	instances.Post("/", postInstance)
+	instances.Get("/s/:shortName", getInstanceByShortName)
 	instances.Get("/:instanceId", getInstance)
 	instances.Get("/:instanceId/join", joinInstance)
 }
 
+// postInstance | POST /instances
+// Creates a new instance with a server-issued nonce & returns it.
+func postInstance(c *fiber.Ctx) error {
+	var u = c.Locals("user").(*models.User)
+	var r CreateInstanceRequest
+	var w models.World
+
+	err := c.BodyParser(&r)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if r.Type == "" {
+		r.Type = "public"
+	}
+
+	tx := config.DB.Where("id = ?", r.WorldID).First(&w)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(models.ErrWorldNotFoundResponse)
+		}
+		return c.Status(500).JSON(models.MakeErrorResponse(tx.Error.Error(), 500))
+	}
+
+	l, err := models.CreateLocation(w.ID, r.Type, u.ID, r.Region, r.CanRequestInvite, r.Strict)
+	if err != nil {
+		if err == models.ErrInvalidInstanceType || err == models.ErrInvalidInstanceRegion {
+			return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+		}
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	shortName, err := models.CreateInstanceShortName(l.ID)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return c.JSON(makeInstanceResponse(l, nil, &w, shortName))
+}
+
+// getInstanceByShortName | GET /instances/s/:shortName
+// Returns an instance based on its short name.
+func getInstanceByShortName(c *fiber.Ctx) error {
+	id, err := models.GetLocationForShortName(c.Params("shortName"))
+	if err != nil {
+		if err == models.ErrInstanceShortNameNotFound {
+			return c.Status(404).JSON(models.ErrInstanceNotFoundResponse)
+		}
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return instanceResponse(c, id)
+}
+
 // getInstance | GET /instances/:instanceId
 // Returns an instance.
 func getInstance(c *fiber.Ctx) error {
+	return instanceResponse(c, c.Params("instanceId"))
+}
+
+func instanceResponse(c *fiber.Ctx, id string) error {
 	var instance *models.WorldInstance
-	id := c.Params("instanceId")
+	var w models.World
 	i, err := models.ParseLocationString(id)
 	if err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
@@ -30,8 +90,12 @@ func getInstance(c *fiber.Ctx) error {
 		}
 	}
 
-	var w models.World
-	tx := config.DB.Find(&w).Where("id = ?", i.WorldID)
+	// Instances that aren't live must carry a valid nonce; we won't vouch for spoofed ownership claims.
+	if instance == nil && i.InstanceType != "public" && !i.IsNonceValid() {
+		return c.Status(404).JSON(models.ErrInstanceNotFoundResponse)
+	}
+
+	tx := config.DB.Where("id = ?", i.WorldID).First(&w)
 	if tx.Error != nil {
 		if tx.Error == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(models.ErrWorldNotFoundResponse)
@@ -39,9 +103,19 @@ func getInstance(c *fiber.Ctx) error {
 		return c.Status(500).JSON(models.MakeErrorResponse(tx.Error.Error(), 500))
 	}
 
+	return c.JSON(makeInstanceResponse(i, instance, &w, models.GetShortNameForLocation(id)))
+}
+
+// makeInstanceResponse builds the API representation of an instance. instance is the live instance as known by
+// Discovery, if any.
+func makeInstanceResponse(i *models.Location, instance *models.WorldInstance, w *models.World, shortName string) fiber.Map {
+	if instance == nil {
+		instance = &models.WorldInstance{}
+	}
+
 	instanceResp := fiber.Map{
-		"id":         id,
-		"location":   id,
+		"id":         i.ID,
+		"location":   i.ID,
 		"instanceId": i.LocationString,
 		"name":       i.InstanceID,
 		"worldId":    i.WorldID,
@@ -57,7 +131,8 @@ func getInstance(c *fiber.Ctx) error {
 			"android":           instance.PlayerCount.PlatformAndroid,
 		},
 		"secureName":       "", // unknown
-		"shortName":        "", // unknown
+		"shortName":        shortName,
+		"nonce":            i.Nonce,
 		"photonRegion":     i.Region,
 		"region":           i.Region,
 		"canRequestInvite": i.CanRequestInvite, // todo: presence/friends required
@@ -69,7 +144,7 @@ func getInstance(c *fiber.Ctx) error {
 		instanceResp[i.InstanceType] = i.OwnerID
 	}
 
-	return c.JSON(instanceResp)
+	return instanceResp
 }
 
 // joinInstance | GET /instances/:instanceId/join
@@ -82,7 +157,7 @@ func joinInstance(c *fiber.Ctx) error {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
 
-	tx := config.DB.Find(&w).Where("id = ?", instance.WorldID)
+	tx := config.DB.Where("id = ?", instance.WorldID).First(&w)
 	if tx.Error != nil {
 		if tx.Error == gorm.ErrRecordNotFound {
 			return c.Status(404).JSON(models.ErrWorldNotFoundResponse)
@@ -90,17 +165,23 @@ func joinInstance(c *fiber.Ctx) error {
 		return c.Status(500).JSON(models.MakeErrorResponse(tx.Error.Error(), 500))
 	}
 
+	var i *models.WorldInstance
 	if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
-		if DiscoveryService.GetInstance(instance.ID) == nil {
-			DiscoveryService.RegisterInstance(instance.ID, w.Capacity)
-		}
+		i = DiscoveryService.GetInstance(instance.ID)
 	}
 
-	t, err := models.CreateJoinToken(c.Locals("user").(*models.User), &w, c.IP(), instance)
+	t, err := models.CreateJoinToken(c.Locals("user").(*models.User), &w, c.IP(), instance, i)
 	if err != nil {
+		if models.IsInstanceAccessError(err) {
+			return c.Status(403).JSON(models.MakeErrorResponse(err.Error(), 403))
+		}
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
 
+	if config.ApiConfiguration.DiscoveryServiceEnabled.Get() && i == nil {
+		DiscoveryService.RegisterInstance(instance.ID, w.Capacity)
+	}
+
 	return c.JSON(fiber.Map{
 		"canModerateInstance": false, // So, err… the official API also returns this as false at all times, because it's not implemented on their end.
 		"token":               t,
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"time"
+)
+
+func inviteRoutes(router *fiber.App) {
+	invite := router.Group("/invite", ApiKeyMiddleware, AuthMiddleware)
+	invite.Post("/:userId", postInvite)
+}
+
+// postInvite | POST /invite/:userId
+// Invites a user to an instance, allowing them to join it regardless of its privacy settings (strict instances excluded).
+// TODO: Deliver the invite as a notification once the notification system (& ws) is implemented.
+func postInvite(c *fiber.Ctx) error {
+	var u = c.Locals("user").(*models.User)
+	var r InviteRequest
+	var instance *models.WorldInstance
+
+	err := c.BodyParser(&r)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if r.InstanceID == "" {
+		return c.Status(400).JSON(models.MakeErrorResponse("Bad request", 400))
+	}
+
+	uid := c.Params("userId")
+	if _, err = models.GetUserById(uid); err != nil {
+		if err == models.ErrUserNotFound {
+			return c.Status(404).JSON(models.MakeErrorResponse(fmt.Sprintf("User %s not found", uid), 404))
+		}
+
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	l, err := models.ParseLocationString(r.InstanceID)
+	if err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+	}
+
+	if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
+		instance = DiscoveryService.GetInstance(l.ID)
+	}
+
+	// Users may only invite others to instances they can join themselves.
+	if err = l.CanJoin(u, instance); err != nil {
+		if models.IsInstanceAccessError(err) {
+			return c.Status(403).JSON(models.MakeErrorResponse(err.Error(), 403))
+		}
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if err = models.CreateInstanceInvite(uid, l.ID); err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	notificationId, _ := uuid.NewUUID()
+	return c.JSON(fiber.Map{
+		"id":             "not_" + notificationId.String(),
+		"type":           "invite",
+		"senderUserId":   u.ID,
+		"senderUsername": u.Username,
+		"receiverUserId": uid,
+		"message":        "",
+		"details": fiber.Map{
+			"worldId": l.ID,
+		},
+		"seen":       false,
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+	})
+}
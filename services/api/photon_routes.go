@@ -4,6 +4,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"gitlab.com/george/shoya-go/config"
 	"gitlab.com/george/shoya-go/models"
+	"log"
 	"strconv"
 	"time"
 )
@@ -92,6 +93,12 @@ func doJoinTokenValidation(c *fiber.Ctx) error {
 		DiscoveryService.AddPlayerToInstance(u.ID, l)
 	}
 
+	if location, err := models.ParseLocationString(l); err == nil {
+		if err = models.AddRecentWorld(u.ID, location.WorldID); err != nil {
+			log.Printf("error adding recent world for %s: %v", u.ID, err)
+		}
+	}
+
 	return c.JSON(r)
 }
 
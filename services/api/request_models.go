@@ -38,6 +38,94 @@ type PlayerModerationRequest struct {
 	Type    models.PlayerModerationType `json:"type"`
 }
 
+// CreateInstanceRequest is the model for requests sent to /instances.
+type CreateInstanceRequest struct {
+	WorldID          string `json:"worldId"`
+	Type             string `json:"type"`
+	Region           string `json:"region"`
+	CanRequestInvite bool   `json:"canRequestInvite"`
+	Strict           bool   `json:"strict"`
+}
+
+// UserStorageOverrideRequest overrides the storage limits of a user. Null limits revert to the configured defaults.
+type UserStorageOverrideRequest struct {
+	QuotaBytes *int64 `json:"quotaBytes"`
+	MaxFiles   *int64 `json:"maxFiles"`
+}
+
+// InfoPushRequest is the model for requests sent to /infoPushes. Omitted fields are left unchanged.
+type InfoPushRequest struct {
+	IsEnabled     *bool                   `json:"isEnabled"`
+	ReleaseStatus *string                 `json:"releaseStatus"`
+	Priority      *int                    `json:"priority"`
+	Tags          *[]string               `json:"tags"`
+	Data          *map[string]interface{} `json:"data"`
+	StartDate     *string                 `json:"startDate"`
+	EndDate       *string                 `json:"endDate"`
+}
+
+// Apply copies the fields present in the request onto the push.
+func (r *InfoPushRequest) Apply(p *config.ApiInfoPush) {
+	if r.IsEnabled != nil {
+		p.IsEnabled = *r.IsEnabled
+	}
+	if r.ReleaseStatus != nil {
+		p.ReleaseStatus = *r.ReleaseStatus
+	}
+	if r.Priority != nil {
+		p.Priority = *r.Priority
+	}
+	if r.Tags != nil {
+		p.Tags = *r.Tags
+	}
+	if r.Data != nil {
+		p.Data = *r.Data
+	}
+	if r.StartDate != nil {
+		p.StartDate = *r.StartDate
+	}
+	if r.EndDate != nil {
+		p.EndDate = *r.EndDate
+	}
+}
+
+// WorldRowRequest is the model for requests sent to /worldRows. Omitted fields are left unchanged.
+type WorldRowRequest struct {
+	Name          *string `json:"name"`
+	Platform      *string `json:"platform"`
+	SortHeading   *string `json:"sortHeading"`
+	SortOrder     *string `json:"sortOrder"`
+	SortOwnership *string `json:"sortOwnership"`
+	Tag           *string `json:"tag"`
+}
+
+// Apply copies the fields present in the request onto the row.
+func (r *WorldRowRequest) Apply(row *config.ApiDynamicWorldRow) {
+	if r.Name != nil {
+		row.Name = *r.Name
+	}
+	if r.Platform != nil {
+		row.Platform = *r.Platform
+	}
+	if r.SortHeading != nil {
+		row.SortHeading = *r.SortHeading
+	}
+	if r.SortOrder != nil {
+		row.SortOrder = *r.SortOrder
+	}
+	if r.SortOwnership != nil {
+		row.SortOwnership = *r.SortOwnership
+	}
+	if r.Tag != nil {
+		row.Tag = *r.Tag
+	}
+}
+
+// InviteRequest is the model for requests sent to /invite/:userId.
+type InviteRequest struct {
+	InstanceID string `json:"instanceId"`
+}
+
 type UpdateUserRequest struct {
 	AcceptedTOSVersion     int      `json:"acceptedTOSVersion"`
 	Bio                    string   `json:"bio"`
@@ -385,6 +473,11 @@ type CreateFileVersionRequest struct {
 	SignatureSizeInBytes int    `json:"signatureSizeInBytes"`
 }
 
+// FinishFileUploadRequest is the model for requests sent to /file/:id/:version/:descriptor/finish.
+type FinishFileUploadRequest struct {
+	ETags []string `json:"etags"` // The ETags of the uploaded parts, ordered by part number. Only used for multipart uploads.
+}
+
 type CreateAvatarRequest struct {
 	ID            string               `json:"id"`
 	AssetUrl      string               `json:"assetUrl"`
@@ -17,6 +17,14 @@ func systemRoutes(router *fiber.App) {
 	router.Get("/config", getConfig)
 
 	router.Get("/infoPush", ApiKeyMiddleware, AuthMiddleware, getInfoPush)
+
+	infoPushes := router.Group("/infoPushes", ApiKeyMiddleware, AuthMiddleware, AdminMiddleware)
+	infoPushes.Get("/", getInfoPushes)
+	infoPushes.Post("/", postInfoPush)
+	infoPushes.Get("/:id", getInfoPushById)
+	infoPushes.Put("/:id", putInfoPush)
+	infoPushes.Delete("/:id", deleteInfoPush)
+
 	router.Put("/logout", ApiKeyMiddleware, AuthMiddleware, putLogout)
 
 	router.Get("/visits", getVisits)
@@ -53,7 +61,13 @@ func getConfig(c *fiber.Ctx) error {
 		Value:    config.ApiConfiguration.ApiKey.Get(),
 		SameSite: "disabled",
 	})
-	return c.JSON(config.NewApiConfigResponse(&config.ApiConfiguration))
+
+	r, err := newClientConfigResponse(c)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return clientJSON(c, config.ApiClientPayloadConfig, r)
 }
 
 func getPing(c *fiber.Ctx) error {
@@ -82,42 +96,122 @@ func getTime(c *fiber.Ctx) error {
 	return c.JSON(time.Now().UTC().Format(time.RFC3339))
 }
 
+// getInfoPush | GET /infoPush
+// Returns the active pushes, ordered by priority. Pushes have to carry all tags in ?require=, and at least one of the
+// tags in ?include= (if any are given).
 func getInfoPush(c *fiber.Ctx) error {
-	// TODO: Refactor to fix a whole host of issues (e.g. duplicate entries)
 	//goland:noinspection GoPreferNilSlice
 	toPush := []config.ApiInfoPush{}
-	requiredTags := strings.Split(c.Query("require"), ",")
-	includedTags := strings.Split(c.Query("include"), ",")
+	requiredTags := splitTags(c.Query("require"))
+	includedTags := splitTags(c.Query("include"))
+	now := time.Now()
 
 	for _, push := range config.ApiConfiguration.InfoPushes.Get() {
-		for _, pushed := range toPush {
-			if push.Id == pushed.Id {
-				break
-			}
+		if push.IsActive(now) && models.MatchesInfoPushTags(&push, requiredTags, includedTags) {
+			toPush = append(toPush, push)
 		}
+	}
 
-	nextPush:
-		for _, tag := range requiredTags {
-			for _, pushTag := range push.Tags {
-				if tag == pushTag {
-					toPush = append(toPush, push)
-					break nextPush
-				}
-			}
-		}
+	models.SortInfoPushes(toPush)
+	return c.JSON(toPush)
+}
+
+// getInfoPushes | GET /infoPushes
+// Returns all pushes, including disabled & scheduled ones.
+func getInfoPushes(c *fiber.Ctx) error {
+	pushes, err := models.GetInfoPushes()
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if pushes == nil {
+		pushes = []config.ApiInfoPush{}
+	}
+
+	return c.JSON(pushes)
+}
+
+// getInfoPushById | GET /infoPushes/:id
+// Returns a single push.
+func getInfoPushById(c *fiber.Ctx) error {
+	p, err := models.GetInfoPush(c.Params("id"))
+	if err != nil {
+		return infoPushErrorResponse(c, err)
+	}
+
+	return c.JSON(p)
+}
+
+// postInfoPush | POST /infoPushes
+// Creates a push. Pushes are disabled unless isEnabled is set.
+func postInfoPush(c *fiber.Ctx) error {
+	var r InfoPushRequest
+	var p config.ApiInfoPush
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+	}
 
-	nextPush2:
-		for _, tag := range includedTags {
-			for _, pushTag := range push.Tags {
-				if tag == pushTag {
-					toPush = append(toPush, push)
-					break nextPush2
-				}
-			}
+	r.Apply(&p)
+	created, err := models.CreateInfoPush(p, c.Locals("user").(*models.User).Username)
+	if err != nil {
+		return infoPushErrorResponse(c, err)
+	}
+
+	return c.JSON(created)
+}
+
+// putInfoPush | PUT /infoPushes/:id
+// Updates the fields of a push that are present in the request.
+func putInfoPush(c *fiber.Ctx) error {
+	var r InfoPushRequest
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+	}
+
+	p, err := models.UpdateInfoPush(c.Params("id"), c.Locals("user").(*models.User).Username, r.Apply)
+	if err != nil {
+		return infoPushErrorResponse(c, err)
+	}
+
+	return c.JSON(p)
+}
+
+// deleteInfoPush | DELETE /infoPushes/:id
+// Deletes a push.
+func deleteInfoPush(c *fiber.Ctx) error {
+	if err := models.DeleteInfoPush(c.Params("id"), c.Locals("user").(*models.User).Username); err != nil {
+		return infoPushErrorResponse(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// infoPushErrorResponse responds with the status code matching an error returned by the infopush models.
+func infoPushErrorResponse(c *fiber.Ctx, err error) error {
+	switch err {
+	case models.ErrInfoPushNotFound:
+		return c.Status(404).JSON(models.MakeErrorResponse(err.Error(), 404))
+	case models.ErrInvalidInfoPushDate, models.ErrInfoPushEndsBeforeStart:
+		return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+	default:
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+}
+
+// splitTags splits a comma-separated list of tags, dropping empty ones.
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
 		}
 	}
 
-	return c.JSON(toPush)
+	return tags
 }
 
 // TODO: Implement active user count
@@ -3,7 +3,6 @@ package api
 import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"github.com/tj/go-naturaldate"
 	"gitlab.com/george/shoya-go/config"
 	"gitlab.com/george/shoya-go/models"
 	"gorm.io/gorm"
@@ -31,6 +30,9 @@ func usersRoutes(router *fiber.App) {
 
 	users.Get("/:id/feedback", getUserFeedback)
 
+	users.Get("/:id/storage", AdminMiddleware, getUserStorage)
+	users.Put("/:id/storage", AdminMiddleware, putUserStorage)
+
 	users.Put("/:id", putUser)
 	users.Delete("/:id", deleteUser)
 }
@@ -117,7 +119,7 @@ func getUser(c *fiber.Ctx) error {
 
 	uid := c.Params("id")
 	if cu.ID == uid {
-		return c.Status(fiber.StatusOK).JSON(cu.GetAPICurrentUser())
+		return clientJSON(c.Status(fiber.StatusOK), config.ApiClientPayloadUser, cu.GetAPICurrentUser())
 	}
 
 	if ru, err = models.GetUserById(uid); err != nil {
@@ -140,7 +142,7 @@ func getUserByUsername(c *fiber.Ctx) error {
 
 	username := strings.ToLower(c.Params("username"))
 	if cu.Username == username {
-		return c.Status(fiber.StatusOK).JSON(cu.GetAPICurrentUser())
+		return clientJSON(c.Status(fiber.StatusOK), config.ApiClientPayloadUser, cu.GetAPICurrentUser())
 	}
 
 	if ru, err = models.GetUserByUsername(username); err != nil {
@@ -311,7 +313,7 @@ func putUser(c *fiber.Ctx) error {
 
 	config.DB.Omit(clause.Associations).Model(&u).Updates(changes)
 
-	return c.Status(fiber.StatusOK).JSON(u.GetAPICurrentUser())
+	return clientJSON(c.Status(fiber.StatusOK), config.ApiClientPayloadUser, u.GetAPICurrentUser())
 
 wrongPassword:
 	return c.Status(400).JSON(models.ErrInvalidCredentialsResponse)
@@ -381,15 +383,19 @@ func postUserModerations(c *fiber.Ctx) error {
 	}
 
 	if req.Type == models.ModerationKick || req.Type == models.ModerationWarn {
-		// TODO: Validate whether the instance is actually active (discovery & presence svc required)
-		//       and whether the user is allowed to moderate that instance once
-		//       multi-mod is implemented
+		// TODO: Validate whether the user is allowed to moderate that instance once multi-mod is implemented
 		i, err := models.ParseLocationString(fmt.Sprintf("%s:%s", req.WorldID, req.InstanceID))
 		if err != nil {
 			return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 		}
 
-		if i.OwnerID != u.ID && !u.IsStaff() {
+		var instance *models.WorldInstance
+		if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
+			instance = DiscoveryService.GetInstance(i.ID)
+		}
+
+		// The owner of a client-built location is only proof of ownership if we issued its nonce, or the instance is live.
+		if !u.IsStaff() && (i.OwnerID != u.ID || (instance == nil && !i.IsNonceValid())) {
 			return c.Status(403).JSON(models.MakeErrorResponse("not authorized to moderate this instance", 403))
 		}
 	}
@@ -401,14 +407,13 @@ func postUserModerations(c *fiber.Ctx) error {
 
 		exp = time.Unix(0, 0) // If expiry is `0`, we'll assume it's permanent.
 	} else {
-		exp, err = naturaldate.Parse(strings.ReplaceAll(req.ExpiresAt, "_", " "), time.Now().UTC(), naturaldate.WithDirection(naturaldate.Future))
+		exp, err = models.ParseModerationExpiry(req.ExpiresAt, time.Now())
+		if err == models.ErrModerationInThePast {
+			return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+		}
 		if err != nil {
 			return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 		}
-
-		if exp.Before(time.Now().UTC()) {
-			return c.Status(400).JSON(models.MakeErrorResponse("cannot create moderation in the past", 400))
-		}
 	}
 
 	mod = &models.Moderation{
@@ -484,7 +489,7 @@ func postUserAddTags(c *fiber.Ctx) error {
 
 	config.DB.Omit(clause.Associations).Model(&u).Updates(changes)
 
-	return c.Status(fiber.StatusOK).JSON(u.GetAPICurrentUser())
+	return clientJSON(c.Status(fiber.StatusOK), config.ApiClientPayloadUser, u.GetAPICurrentUser())
 
 badRequest:
 	return c.Status(400).JSON(models.MakeErrorResponse("Bad request", 400))
@@ -532,7 +537,7 @@ func postUserRemoveTags(c *fiber.Ctx) error {
 
 	config.DB.Omit(clause.Associations).Model(&u).Updates(changes)
 
-	return c.Status(fiber.StatusOK).JSON(u.GetAPICurrentUser())
+	return clientJSON(c.Status(fiber.StatusOK), config.ApiClientPayloadUser, u.GetAPICurrentUser())
 
 badRequest:
 	return c.Status(400).JSON(models.MakeErrorResponse("Bad request", 400))
@@ -560,5 +565,48 @@ func getUserAvatar(c *fiber.Ctx) error {
 	if a, err = u.CurrentAvatar.GetAPIAvatar(); err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
-	return c.JSON(a)
+	return clientJSON(c, config.ApiClientPayloadAvatar, a)
+}
+
+// getUserStorage | GET /users/:id/storage
+// Returns a user's storage usage & limits. Staff only.
+func getUserStorage(c *fiber.Ctx) error {
+	usage, err := models.GetStorageUsageByUserId(c.Params("id"))
+	if err != nil {
+		if err == models.ErrUserNotFound {
+			return c.Status(404).JSON(models.MakeErrorResponse(fmt.Sprintf("User %s not found", c.Params("id")), 404))
+		}
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return c.JSON(usage)
+}
+
+// putUserStorage | PUT /users/:id/storage
+// Overrides a user's storage limits. Limits that are null (or missing) revert to the configured defaults. Staff only.
+func putUserStorage(c *fiber.Ctx) error {
+	var r UserStorageOverrideRequest
+
+	err := c.BodyParser(&r)
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if (r.QuotaBytes != nil && *r.QuotaBytes < 0) || (r.MaxFiles != nil && *r.MaxFiles < 0) {
+		return c.Status(400).JSON(models.MakeErrorResponse("limits can not be negative", 400))
+	}
+
+	tx := config.DB.Model(&models.User{}).Where("id = ?", c.Params("id")).Updates(map[string]interface{}{
+		"storage_quota_bytes_override": r.QuotaBytes,
+		"storage_max_files_override":   r.MaxFiles,
+	})
+	if tx.Error != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(tx.Error.Error(), 500))
+	}
+
+	if tx.RowsAffected == 0 {
+		return c.Status(404).JSON(models.MakeErrorResponse(fmt.Sprintf("User %s not found", c.Params("id")), 404))
+	}
+
+	return getUserStorage(c)
 }
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+)
+
+func worldRowsRoutes(router *fiber.App) {
+	rows := router.Group("/worldRows", ApiKeyMiddleware, AuthMiddleware, AdminMiddleware)
+	rows.Get("/", getWorldRows)
+	rows.Post("/", postWorldRow)
+	rows.Put("/:index", putWorldRow)
+	rows.Put("/:index/move/:to", putWorldRowMove)
+	rows.Delete("/:index", deleteWorldRow)
+
+	picks := router.Group("/worldStaffPicks", ApiKeyMiddleware, AuthMiddleware, AdminMiddleware)
+	picks.Get("/", getWorldStaffPicks)
+	picks.Put("/:id", putWorldStaffPick)
+	picks.Delete("/:id", deleteWorldStaffPick)
+}
+
+// applyWorldSort applies the sort & order of a /worlds request to the query. Sorts that are resolved from a list of
+// world ids (popular, staffpicks) restrict the query to every id of the list & order it like the list, so the filters of
+// the request are applied before the page is; the amount of worlds per page is then the same as for any other sort.
+func applyWorldSort(tx *gorm.DB, sort models.WorldSort, order string) {
+	var ids []string
+	direction := " DESC"
+	if order == "ascending" {
+		direction = " ASC"
+	}
+
+	switch sort {
+	case models.WorldSortPopular:
+		ids = []string{}
+		if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
+			for _, o := range DiscoveryService.GetActiveWorlds(0, 0) {
+				ids = append(ids, o.WorldID)
+			}
+		}
+	case models.WorldSortStaffPicks:
+		ids = append([]string{}, config.ApiConfiguration.WorldStaffPicks.Get()...)
+	case models.WorldSortNew:
+		tx.Order("created_at" + direction)
+	case models.WorldSortUpdated:
+		tx.Order("updated_at" + direction)
+	case models.WorldSortName:
+		tx.Order("name" + direction)
+	case models.WorldSortShuffle:
+		tx.Order("random()")
+	}
+
+	if ids != nil {
+		restrictToWorldIds(tx, ids)
+	}
+}
+
+// restrictToWorldIds restricts the query to the worlds in the list of ids, ordered like the list.
+func restrictToWorldIds(tx *gorm.DB, ids []string) {
+	tx.Where("id IN ?", ids).Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "array_position(?::text[], id)",
+		Vars:               []interface{}{pq.StringArray(ids)},
+		WithoutParentheses: true,
+	}})
+}
+
+// getWorldRows | GET /worldRows
+// Returns the dynamic world rows as they are stored, ordered by their index.
+func getWorldRows(c *fiber.Ctx) error {
+	rows, err := models.GetDynamicWorldRows()
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if rows == nil {
+		rows = []config.ApiDynamicWorldRow{}
+	}
+
+	return c.JSON(rows)
+}
+
+// postWorldRow | POST /worldRows
+// Adds a dynamic world row after the existing ones.
+func postWorldRow(c *fiber.Ctx) error {
+	var r WorldRowRequest
+	var row config.ApiDynamicWorldRow
+
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+	}
+
+	r.Apply(&row)
+	created, err := models.AddDynamicWorldRow(row, c.Locals("user").(*models.User).Username)
+	if err != nil {
+		return worldRowErrorResponse(c, err)
+	}
+
+	return c.JSON(created)
+}
+
+// putWorldRow | PUT /worldRows/:index
+// Updates the fields of a dynamic world row that are present in the request.
+func putWorldRow(c *fiber.Ctx) error {
+	var r WorldRowRequest
+
+	index, err := strconv.Atoi(c.Params("index"))
+	if err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid row index", 400))
+	}
+
+	if err = c.BodyParser(&r); err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+	}
+
+	row, err := models.UpdateDynamicWorldRow(index, c.Locals("user").(*models.User).Username, r.Apply)
+	if err != nil {
+		return worldRowErrorResponse(c, err)
+	}
+
+	return c.JSON(row)
+}
+
+// putWorldRowMove | PUT /worldRows/:index/move/:to
+// Moves a dynamic world row to another index.
+func putWorldRowMove(c *fiber.Ctx) error {
+	index, err := strconv.Atoi(c.Params("index"))
+	if err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid row index", 400))
+	}
+
+	to, err := strconv.Atoi(c.Params("to"))
+	if err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid row index", 400))
+	}
+
+	if err = models.MoveDynamicWorldRow(index, to, c.Locals("user").(*models.User).Username); err != nil {
+		return worldRowErrorResponse(c, err)
+	}
+
+	return getWorldRows(c)
+}
+
+// deleteWorldRow | DELETE /worldRows/:index
+// Removes a dynamic world row.
+func deleteWorldRow(c *fiber.Ctx) error {
+	index, err := strconv.Atoi(c.Params("index"))
+	if err != nil {
+		return c.Status(400).JSON(models.MakeErrorResponse("invalid row index", 400))
+	}
+
+	if err = models.RemoveDynamicWorldRow(index, c.Locals("user").(*models.User).Username); err != nil {
+		return worldRowErrorResponse(c, err)
+	}
+
+	return getWorldRows(c)
+}
+
+// getWorldStaffPicks | GET /worldStaffPicks
+// Returns the ids of the staff picked worlds, in order.
+func getWorldStaffPicks(c *fiber.Ctx) error {
+	ids, err := models.GetWorldStaffPicks()
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if ids == nil {
+		ids = []string{}
+	}
+
+	return c.JSON(ids)
+}
+
+// putWorldStaffPick | PUT /worldStaffPicks/:id
+// Adds a world to the staff picks, at ?position= if given (or last otherwise).
+func putWorldStaffPick(c *fiber.Ctx) error {
+	var position = -1
+	var err error
+
+	if _p := c.Query("position"); _p != "" {
+		if position, err = strconv.Atoi(_p); err != nil {
+			return c.Status(400).JSON(models.MakeErrorResponse("invalid position", 400))
+		}
+	}
+
+	if err = models.AddWorldStaffPick(c.Params("id"), position, c.Locals("user").(*models.User).Username); err != nil {
+		return worldRowErrorResponse(c, err)
+	}
+
+	return getWorldStaffPicks(c)
+}
+
+// deleteWorldStaffPick | DELETE /worldStaffPicks/:id
+// Removes a world from the staff picks.
+func deleteWorldStaffPick(c *fiber.Ctx) error {
+	if err := models.RemoveWorldStaffPick(c.Params("id"), c.Locals("user").(*models.User).Username); err != nil {
+		return worldRowErrorResponse(c, err)
+	}
+
+	return getWorldStaffPicks(c)
+}
+
+// worldRowErrorResponse responds with the status code matching an error returned by the world row models.
+func worldRowErrorResponse(c *fiber.Ctx, err error) error {
+	switch err {
+	case models.ErrWorldRowNotFound, models.ErrWorldNotFound, models.ErrWorldNotStaffPicked:
+		return c.Status(404).JSON(models.MakeErrorResponse(err.Error(), 404))
+	case models.ErrInvalidWorldRowName, models.ErrInvalidWorldSort, models.ErrInvalidWorldSortOrder, models.ErrInvalidWorldSortOwnership:
+		return c.Status(400).JSON(models.MakeErrorResponse(err.Error(), 400))
+	default:
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+}
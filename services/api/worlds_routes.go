@@ -31,15 +31,14 @@ func worldsRoutes(app *fiber.App) {
 // getWorlds | GET /worlds
 //
 // This route retrieves a list of worlds based on various parameters (e.g.: search, offset, number).
+// Dynamic world rows are resolved through ?sort= (see models.WorldSort), ?order=, ?tag= and ?user=me.
 func getWorlds(c *fiber.Ctx) error {
-	var isGameRequest = c.Locals("isGameRequest").(bool)
 	var worlds []models.World
-	var apiWorlds = make([]*models.APIWorld, 0)
-	var apiWorldsPackages = make([]*models.APIWorldWithPackages, 0)
 	var u = c.Locals("user").(*models.User)
 	var numberOfWorldsToSearch = 60
 	var worldsOffset = 0
-	var searchSort = ""
+	var searchSort models.WorldSort
+	var searchOrder = "descending"
 	var searchTerm = ""
 	var searchTagsInclude = make([]string, 0)
 	var searchTagsExclude = make([]string, 0)
@@ -47,9 +46,6 @@ func getWorlds(c *fiber.Ctx) error {
 	var searchUser = ""
 	var searchReleaseStatus = models.ReleaseStatusPublic
 
-	var is [][]string
-	var i []*models.WorldInstance
-
 	// Query preparation
 	var tx = config.DB.Model(&models.World{}).
 		Preload("Image").
@@ -132,8 +128,19 @@ func getWorlds(c *fiber.Ctx) error {
 		}
 	}
 
+	// The client sends sorts we don't resolve (e.g.: relevance, favorites); those fall back to the default order.
 	if _s := c.Query("sort"); _s != "" {
-		searchSort = _s
+		if ws, err := models.ParseWorldSort(_s); err == nil {
+			searchSort = ws
+		}
+	}
+
+	if _o := c.Query("order"); _o != "" {
+		if _o != "ascending" && _o != "descending" {
+			goto badRequest
+		}
+
+		searchOrder = _o
 	}
 
 	// Additional query prep based on parameters
@@ -159,9 +166,7 @@ func getWorlds(c *fiber.Ctx) error {
 	}
 
 	if searchSort != "" {
-		if searchSort == "shuffle" {
-			tx.Order("random()")
-		}
+		applyWorldSort(tx, searchSort, searchOrder)
 	}
 
 	if searchReleaseStatus != models.ReleaseStatusPublic {
@@ -179,46 +184,7 @@ func getWorlds(c *fiber.Ctx) error {
 
 	tx.Find(&worlds)
 
-	if isGameRequest {
-		for _, world := range worlds {
-			wp, err := world.GetAPIWorldWithPackages()
-			if err != nil {
-				return err
-			}
-
-			if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
-				i = DiscoveryService.GetInstancesForWorld(wp.ID)
-				is = make([][]string, len(i))
-				for idx, _i := range i {
-					is[idx] = []string{_i.InstanceID, fmt.Sprintf("%d", _i.PlayerCount.Total)}
-				}
-				wp.Instances = is
-			}
-
-			apiWorldsPackages = append(apiWorldsPackages, wp)
-		}
-		return c.JSON(apiWorldsPackages)
-	} else {
-		for _, world := range worlds {
-			w, err := world.GetAPIWorld()
-			if err != nil {
-				return err
-			}
-
-			if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
-				i = DiscoveryService.GetInstancesForWorld(w.ID)
-				is = make([][]string, len(i))
-				for idx, _i := range i {
-					is[idx] = []string{_i.InstanceID, fmt.Sprintf("%d", _i.PlayerCount.Total)}
-				}
-				w.Instances = is
-			}
-
-			apiWorlds = append(apiWorlds, w)
-		}
-
-		return c.JSON(apiWorlds)
-	}
+	return worldsResponse(c, worlds)
 
 badRequest:
 	return c.Status(400).JSON(models.MakeErrorResponse("Bad request", 400))
@@ -327,7 +293,7 @@ func postWorlds(c *fiber.Ctx) error {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
 
-	return c.JSON(aw)
+	return clientJSON(c, config.ApiClientPayloadWorld, aw)
 }
 
 // getWorldFavorites | GET /worlds/favorites
@@ -339,16 +305,159 @@ func getWorldFavorites(c *fiber.Ctx) error {
 
 // getWorldsActive | GET /worlds/active
 // Returns the most active (in terms of ccu) worlds.
-// TODO: Implement presence & world metrics
 func getWorldsActive(c *fiber.Ctx) error {
-	return c.JSON([]struct{}{})
+	var numberOfWorldsToSearch = 60
+	var worldsOffset = 0
+	var ids []string
+	var worlds []models.World
+	var err error
+
+	if _n := c.Query("n"); _n != "" {
+		atoi, err := strconv.Atoi(_n)
+		if err != nil {
+			goto badRequest
+		}
+
+		if atoi < 1 || atoi > 100 {
+			goto badRequest
+		}
+
+		numberOfWorldsToSearch = atoi
+	}
+
+	if _o := c.Query("offset"); _o != "" {
+		atoi, err := strconv.Atoi(_o)
+		if err != nil {
+			goto badRequest
+		}
+
+		if atoi < 0 {
+			goto badRequest
+		}
+
+		worldsOffset = atoi
+	}
+
+	if !config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
+		return c.JSON([]struct{}{})
+	}
+
+	for _, o := range DiscoveryService.GetActiveWorlds(0, 0) {
+		ids = append(ids, o.WorldID)
+	}
+
+	// The worlds the user can't see are left out before the page is taken, so that pages are neither short nor shifted.
+	if len(ids) != 0 {
+		tx := config.DB.Model(&models.World{})
+		if u := c.Locals("user").(*models.User); !u.IsStaff() {
+			tx.Where("release_status = ? OR author_id = ?", models.ReleaseStatusPublic, u.ID)
+		}
+		restrictToWorldIds(tx, ids)
+
+		var page []string
+		if err = tx.Limit(numberOfWorldsToSearch).Offset(worldsOffset).Pluck("id", &page).Error; err != nil {
+			return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+		}
+		ids = page
+	}
+
+	if worlds, err = models.GetWorldsByIds(ids); err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return worldsResponse(c, worlds)
+
+badRequest:
+	return c.Status(400).JSON(models.MakeErrorResponse("Bad request", 400))
 }
 
 // getWorldsRecent | GET /worlds/recent
 // Returns the most recent worlds the user has been in.
-// TODO: Implement presence.
 func getWorldsRecent(c *fiber.Ctx) error {
-	return c.JSON([]struct{}{})
+	var u = c.Locals("user").(*models.User)
+	var ids []string
+	var worlds []models.World
+	var err error
+
+	if ids, err = models.GetRecentWorlds(u.ID); err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	if worlds, err = models.GetWorldsByIds(ids); err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
+	}
+
+	return worldsResponse(c, filterVisibleWorlds(u, worlds))
+}
+
+// filterVisibleWorlds removes the worlds that the user should not be able to see from a list of worlds.
+func filterVisibleWorlds(u *models.User, worlds []models.World) []models.World {
+	var r = make([]models.World, 0, len(worlds))
+	for _, w := range worlds {
+		if w.ReleaseStatus == models.ReleaseStatusPublic || w.AuthorID == u.ID || u.IsStaff() {
+			r = append(r, w)
+		}
+	}
+
+	return r
+}
+
+// worldsResponse returns a list of worlds as either APIWorld, or APIWorldWithPackages.
+// It varies based on the request source (see: IsGameRequestMiddleware)
+func worldsResponse(c *fiber.Ctx, worlds []models.World) error {
+	var wis map[string]*models.WorldInstances
+	if config.ApiConfiguration.DiscoveryServiceEnabled.Get() && len(worlds) > 0 {
+		ids := make([]string, len(worlds))
+		for idx, world := range worlds {
+			ids[idx] = world.ID
+		}
+		wis = DiscoveryService.GetInstancesForWorlds(ids)
+	}
+
+	if c.Locals("isGameRequest").(bool) {
+		var apiWorldsPackages = make([]*models.APIWorldWithPackages, 0)
+		for _, world := range worlds {
+			wp, err := world.GetAPIWorldWithPackages()
+			if err != nil {
+				return err
+			}
+
+			fillWorldDiscoveryData(&wp.APIWorld, wis[wp.ID])
+			apiWorldsPackages = append(apiWorldsPackages, wp)
+		}
+
+		return clientJSON(c, config.ApiClientPayloadWorld, apiWorldsPackages)
+	}
+
+	var apiWorlds = make([]*models.APIWorld, 0)
+	for _, world := range worlds {
+		w, err := world.GetAPIWorld()
+		if err != nil {
+			return err
+		}
+
+		fillWorldDiscoveryData(w, wis[w.ID])
+		apiWorlds = append(apiWorlds, w)
+	}
+
+	return clientJSON(c, config.ApiClientPayloadWorld, apiWorlds)
+}
+
+// fillWorldDiscoveryData fills in the live instances & occupancy of a world from its Discovery lookup.
+func fillWorldDiscoveryData(w *models.APIWorld, wi *models.WorldInstances) {
+	if wi == nil {
+		return
+	}
+
+	is := make([][]string, len(wi.Instances))
+	for idx, _i := range wi.Instances {
+		is[idx] = []string{_i.InstanceID, fmt.Sprintf("%d", _i.PlayerCount.Total)}
+	}
+	w.Instances = is
+
+	w.Occupants = wi.Occupancy.Occupants
+	w.PublicOccupants = wi.Occupancy.PublicOccupants
+	w.PrivateOccupants = wi.Occupancy.PrivateOccupants
 }
 
 // getWorld | GET /worlds/:id
@@ -363,9 +472,6 @@ func getWorld(c *fiber.Ctx) error {
 	var aw *models.APIWorld
 	var awp *models.APIWorldWithPackages
 
-	var is [][]string
-	var i []*models.WorldInstance
-
 	var err error
 
 	if w, err = models.GetWorldById(c.Params("id")); err != nil {
@@ -378,37 +484,27 @@ func getWorld(c *fiber.Ctx) error {
 
 	if isGameRequest {
 		awp, err = w.GetAPIWorldWithPackages()
-		if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
-			i = DiscoveryService.GetInstancesForWorld(awp.ID)
-		}
 	} else {
 		aw, err = w.GetAPIWorld()
-		if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
-			i = DiscoveryService.GetInstancesForWorld(aw.ID)
-		}
 	}
 
-	if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
-		is = make([][]string, len(i))
-		for idx, _i := range i {
-			is[idx] = []string{_i.InstanceID, fmt.Sprintf("%d", _i.PlayerCount.Total)}
-		}
+	if err != nil {
+		return c.Status(500).JSON(models.MakeErrorResponse("internal server error while trying to get apiworld", 500))
+	}
 
+	if config.ApiConfiguration.DiscoveryServiceEnabled.Get() {
+		wis := DiscoveryService.GetInstancesForWorlds([]string{w.ID})
 		if isGameRequest {
-			awp.Instances = is
+			fillWorldDiscoveryData(&awp.APIWorld, wis[w.ID])
 		} else {
-			aw.Instances = is
+			fillWorldDiscoveryData(aw, wis[w.ID])
 		}
 	}
 
-	if err != nil {
-		return c.Status(500).JSON(models.MakeErrorResponse("internal server error while trying to get apiworld", 500))
-	}
-
 	if isGameRequest {
-		return c.JSON(awp)
+		return clientJSON(c, config.ApiClientPayloadWorld, awp)
 	} else {
-		return c.JSON(aw)
+		return clientJSON(c, config.ApiClientPayloadWorld, aw)
 	}
 }
 
@@ -543,7 +639,7 @@ func putWorld(c *fiber.Ctx) error {
 	if aw, err = w.GetAPIWorldWithPackages(); err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
-	return c.JSON(aw)
+	return clientJSON(c, config.ApiClientPayloadWorld, aw)
 }
 
 // deleteWorld | DELETE /worlds/:id
@@ -575,7 +671,7 @@ func deleteWorld(c *fiber.Ctx) error {
 	if aw, err = w.GetAPIWorld(); err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
-	return c.JSON(aw)
+	return clientJSON(c, config.ApiClientPayloadWorld, aw)
 }
 
 // getWorldMeta | GET /worlds/:id/metadata
@@ -666,7 +762,7 @@ func putWorldPublish(c *fiber.Ctx) error {
 	if aw, err = w.GetAPIWorld(); err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
-	return c.JSON(aw)
+	return clientJSON(c, config.ApiClientPayloadWorld, aw)
 }
 
 func deleteWorldPublish(c *fiber.Ctx) error {
@@ -694,5 +790,5 @@ func deleteWorldPublish(c *fiber.Ctx) error {
 	if aw, err = w.GetAPIWorld(); err != nil {
 		return c.Status(500).JSON(models.MakeErrorResponse(err.Error(), 500))
 	}
-	return c.JSON(aw)
+	return clientJSON(c, config.ApiClientPayloadWorld, aw)
 }
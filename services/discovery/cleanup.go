@@ -0,0 +1,203 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rueian/rueidis"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"log"
+	"strconv"
+	"time"
+)
+
+const cleanupLeaderKey = "discovery:cleanup:leader"
+
+// replicaId uniquely identifies this replica of the Discovery service when contending for cleanup leadership.
+var replicaId = uuid.NewString()
+
+// cleanupLeaderScript acquires the cleanup leadership lock, or extends it if this replica already holds it.
+var cleanupLeaderScript = rueidis.NewLuaScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// cleanupSettings returns the configured cleanup settings, falling back to the defaults for unset values.
+func cleanupSettings() (ttl time.Duration, interval time.Duration, batchSize int64) {
+	ttl = time.Hour
+	interval = 30 * time.Second
+	batchSize = 100
+
+	if s := config.RuntimeConfig.Discovery.InstanceTtlSeconds; s > 0 {
+		ttl = time.Duration(s) * time.Second
+	}
+
+	if s := config.RuntimeConfig.Discovery.CleanupIntervalSeconds; s > 0 {
+		interval = time.Duration(s) * time.Second
+	}
+
+	if s := config.RuntimeConfig.Discovery.CleanupBatchSize; s > 0 {
+		batchSize = int64(s)
+	}
+
+	return ttl, interval, batchSize
+}
+
+// instanceCleanup periodically removes stale instances & dangling player entries. Only one replica (the leader) sweeps
+// at any given time; leadership is held through a lock in Redis which expires if the leader stops renewing it.
+func instanceCleanup() {
+	ttl, interval, batchSize := cleanupSettings()
+	for {
+		if isCleanupLeader(interval * 3) {
+			cleanupStaleInstances(ttl, batchSize)
+			cleanupDanglingPlayers(batchSize)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// isCleanupLeader attempts to acquire (or renew) the cleanup leadership lock for this replica.
+func isCleanupLeader(lockTtl time.Duration) bool {
+	r, err := cleanupLeaderScript.Exec(RedisCtx, RedisClient, []string{cleanupLeaderKey}, []string{replicaId, strconv.FormatInt(lockTtl.Milliseconds(), 10)}).ToInt64()
+	if err != nil {
+		log.Printf("error acquiring cleanup leadership: %s\n", err.Error())
+		return false
+	}
+
+	return r == 1
+}
+
+// cleanupStaleInstances removes instances which have not been pinged within the ttl, in batches of batchSize.
+func cleanupStaleInstances(ttl time.Duration, batchSize int64) {
+	var cleaned int
+	var cutoff = time.Now().UTC().Add(-ttl).Unix()
+
+	for {
+		arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index("instancePingTimeIdx").Query(fmt.Sprintf("@lastPing:[-inf %d]", cutoff)).Limit().OffsetNum(0, batchSize).Build()).ToArray()
+		if err != nil {
+			log.Println(err)
+			break
+		}
+
+		var n int64
+		var p []FtSearchResult
+		n, p, err = parseFtSearch(arr)
+		if err != nil {
+			if err != NotFoundErr {
+				log.Println(err)
+			}
+			break
+		}
+
+		var failed bool
+		for _, val := range p {
+			i := &models.WorldInstance{}
+			err = json.Unmarshal([]byte(val.Results["$"]), &i)
+			if err != nil {
+				log.Printf("error decoding instance %s: %s\n", val.Key, err.Error())
+			}
+
+			err = RedisClient.Do(RedisCtx, RedisClient.B().Del().Key(val.Key).Build()).Error()
+			if err != nil {
+				log.Printf("error deleting instance: %s\n", err.Error())
+				failed = true
+				continue
+			}
+
+			cleaned++
+			if i.InstanceID != "" {
+				publishInstanceClosed(i)
+			}
+		}
+
+		// Deleted instances drop out of the index, so the next batch is always at offset 0. Bail if deleting failed, as
+		// we'd otherwise keep fetching the same batch over and over again.
+		if failed || n < batchSize {
+			break
+		}
+	}
+
+	if cleaned >= 1 {
+		log.Printf("Cleanup Routine - Cleaned up %d instances.", cleaned)
+	}
+}
+
+// cleanupDanglingPlayers removes players who are listed in more than one instance (e.g.: because a leave callback was
+// never received) from every instance but the most recently pinged one.
+func cleanupDanglingPlayers(batchSize int64) {
+	var cleaned int
+	var offset int64
+	var playerInstances = map[string][]*models.WorldInstance{}
+
+	for {
+		arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index("instancePlayersIdx").Query("*").Limit().OffsetNum(offset, batchSize).Build()).ToArray()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		var n int64
+		var p []FtSearchResult
+		n, p, err = parseFtSearch(arr)
+		if err != nil {
+			if err != NotFoundErr {
+				log.Println(err)
+			}
+			break
+		}
+
+		for _, val := range p {
+			i := &models.WorldInstance{}
+			err = json.Unmarshal([]byte(val.Results["$"]), &i)
+			if err != nil {
+				log.Printf("error decoding instance %s: %s\n", val.Key, err.Error())
+				continue
+			}
+
+			for _, player := range i.Players {
+				playerInstances[player] = append(playerInstances[player], i)
+			}
+		}
+
+		if n < batchSize {
+			break
+		}
+		offset += batchSize
+	}
+
+	for player, instances := range playerInstances {
+		if len(instances) < 2 {
+			continue
+		}
+
+		newest := instances[0]
+		for _, i := range instances[1:] {
+			if i.LastPing > newest.LastPing {
+				newest = i
+			}
+		}
+
+		for _, i := range instances {
+			if i == newest {
+				continue
+			}
+
+			if err := removePlayerEntry(i.ID, player); err != nil {
+				log.Printf("error removing dangling player %s from %s: %s\n", player, i.ID, err.Error())
+				continue
+			}
+			cleaned++
+		}
+	}
+
+	if cleaned >= 1 {
+		log.Printf("Cleanup Routine - Cleaned up %d dangling player entries.", cleaned)
+	}
+}
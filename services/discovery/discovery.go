@@ -10,15 +10,14 @@ import (
 	"gitlab.com/george/shoya-go/models"
 	"log"
 	"strconv"
-	"time"
 )
 
 var RedisClient rueidis.Client
 var RedisCtx = context.Background()
 
 func Main() {
-	if config.RuntimeConfig.Discovery == nil {
-		log.Fatalf("error reading config: RuntimeConfig.Discovery was nil")
+	if err := config.RuntimeConfig.Require("discovery"); err != nil {
+		log.Fatalf("error reading config: %v", err)
 	}
 
 	initializeRedis()
@@ -65,13 +64,19 @@ func Main() {
 		return c.JSON(i)
 	})
 
-	app.Get("/world/:worldId", func(c *fiber.Ctx) error {
-		i, err := findInstancesForWorldId(escapeId(c.Params("worldId")), "public", false)
-		if err != nil {
-			if err == NotFoundErr {
-				return c.SendStatus(404)
-			}
+	app.Post("/worlds/instances", func(c *fiber.Ctx) error {
+		var r struct {
+			WorldIds []string `json:"worldIds"`
+		}
 
+		if err := c.BodyParser(&r); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		i, err := getInstancesForWorldIds(r.WorldIds)
+		if err != nil {
 			fmt.Println(err)
 			return c.Status(500).JSON(fiber.Map{
 				"error": err.Error(),
@@ -81,6 +86,44 @@ func Main() {
 		return c.JSON(i)
 	})
 
+	app.Get("/worlds/active", func(c *fiber.Ctx) error {
+		o, err := getActiveWorlds()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		var n = len(o)
+		var offset = 0
+		if _n := c.Query("n"); _n != "" {
+			if n, err = strconv.Atoi(_n); err != nil || n < 0 {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "n must be a positive number",
+				})
+			}
+		}
+
+		if _o := c.Query("offset"); _o != "" {
+			if offset, err = strconv.Atoi(_o); err != nil || offset < 0 {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "offset must be a positive number",
+				})
+			}
+		}
+
+		if offset > len(o) {
+			offset = len(o)
+		}
+
+		if offset+n > len(o) {
+			n = len(o) - offset
+		}
+
+		return c.JSON(o[offset : offset+n])
+	})
+
 	app.Post("/register/:instanceId", func(c *fiber.Ctx) error {
 		var capacity int
 		id := c.Params("instanceId")
@@ -135,7 +178,12 @@ func Main() {
 
 	app.Post("/unregister/:instanceId", func(c *fiber.Ctx) error {
 		i := c.Params("instanceId")
-		err := unregisterInstance(i)
+		instance, err := getInstance(i)
+		if err != nil && err != NotFoundErr {
+			fmt.Println(err)
+		}
+
+		err = unregisterInstance(i)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"error":      err.Error(),
@@ -143,6 +191,10 @@ func Main() {
 			})
 		}
 
+		if instance != nil {
+			publishInstanceClosed(instance)
+		}
+
 		return c.SendStatus(200)
 	})
 
@@ -239,34 +291,3 @@ func initializeRedis() {
 			Build())
 	}
 }
-
-func instanceCleanup() {
-	var currentTime = int64(0)
-	for {
-		currentTime = time.Now().UTC().Unix()
-
-		arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index("instancePingTimeIdx").Query(fmt.Sprintf("@lastPing:[-inf %d]", currentTime-3600)).Build()).ToArray()
-		if err != nil {
-			log.Println(err)
-			time.Sleep(30 * time.Second)
-			continue
-		}
-
-		var n int64
-		var p []FtSearchResult
-		n, p, err = parseFtSearch(arr)
-
-		if n >= 1 {
-			log.Printf("Cleanup Routine - Cleaned up %d instances.", n)
-		}
-
-		for _, val := range p {
-			err = RedisClient.Do(RedisCtx, RedisClient.B().Del().Key(val.Key).Build()).Error()
-			if err != nil {
-				log.Printf("error deleting instance: %s\n", err.Error())
-			}
-		}
-
-		time.Sleep(30 * time.Second)
-	}
-}
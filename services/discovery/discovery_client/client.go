@@ -4,6 +4,7 @@
 package discovery_client
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -45,15 +46,17 @@ func (d *Discovery) GetInstance(instance string) *models.WorldInstance {
 	return i
 }
 
-// GetInstancesForWorld retrieves a list of instances for a specified world id.
-func (d *Discovery) GetInstancesForWorld(world string) []*models.WorldInstance {
-	var i []*models.WorldInstance
+// GetInstancesForWorlds retrieves the joinable instances & occupancy of many worlds in a single request.
+func (d *Discovery) GetInstancesForWorlds(worlds []string) map[string]*models.WorldInstances {
+	var i map[string]*models.WorldInstances
 
-	b, err := d.doRequest(http.MethodGet, fmt.Sprintf("%s/world/%s", d.Url, world))
+	body, err := json.Marshal(map[string][]string{"worldIds": worlds})
+	if err != nil {
+		return nil
+	}
+
+	b, err := d.doRequestWithBody(http.MethodPost, fmt.Sprintf("%s/worlds/instances", d.Url), bytes.NewReader(body))
 	if err != nil {
-		if err == NotFoundErr {
-			return nil
-		}
 		return nil
 	}
 
@@ -65,6 +68,29 @@ func (d *Discovery) GetInstancesForWorld(world string) []*models.WorldInstance {
 	return i
 }
 
+// GetActiveWorlds retrieves the occupancy of the worlds with players in them, sorted by the amount of players. An n of 0
+// retrieves every active world.
+func (d *Discovery) GetActiveWorlds(n, offset int) []*models.WorldOccupancy {
+	var o []*models.WorldOccupancy
+
+	u := fmt.Sprintf("%s/worlds/active?offset=%d", d.Url, offset)
+	if n > 0 {
+		u += fmt.Sprintf("&n=%d", n)
+	}
+
+	b, err := d.doRequest(http.MethodGet, u)
+	if err != nil {
+		return nil
+	}
+
+	err = json.Unmarshal(b, &o)
+	if err != nil {
+		return nil
+	}
+
+	return o
+}
+
 // RegisterInstance registers an instance in Redis.
 func (d *Discovery) RegisterInstance(instance string, capacity int) *models.WorldInstance {
 	var i *models.WorldInstance
@@ -118,8 +144,15 @@ func (d *Discovery) RemovePlayerFromInstance(player, instance string) {
 }
 
 func (d *Discovery) doRequest(method, url string) ([]byte, error) {
-	r, _ := http.NewRequest(method, url, nil)
+	return d.doRequestWithBody(method, url, nil)
+}
+
+func (d *Discovery) doRequestWithBody(method, url string, body io.Reader) ([]byte, error) {
+	r, _ := http.NewRequest(method, url, body)
 	r.Header.Add("Authorization", d.ApiKey)
+	if body != nil {
+		r.Header.Add("Content-Type", "application/json")
+	}
 
 	do, err := d.c.Do(r)
 	if err != nil {
@@ -0,0 +1,41 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.com/george/shoya-go/models"
+)
+
+// InstanceEventsChannel is the Redis Pub/Sub channel instance lifecycle events are published to.
+const InstanceEventsChannel = "discovery:events"
+
+const InstanceEventClosed = "closed"
+
+// InstanceEvent is published on InstanceEventsChannel whenever the lifecycle of an instance changes.
+type InstanceEvent struct {
+	Type       string   `json:"type"`
+	InstanceID string   `json:"instanceId"` // entire string
+	WorldID    string   `json:"worldId"`
+	Players    []string `json:"players"` // The players that were in the instance when the event occurred
+}
+
+// publishInstanceClosed announces that an instance no longer exists, so that consumers (e.g.: presence) can clean up
+// any state they hold for the players who were in it.
+func publishInstanceClosed(i *models.WorldInstance) {
+	e := InstanceEvent{
+		Type:       InstanceEventClosed,
+		InstanceID: i.InstanceID,
+		WorldID:    i.WorldID,
+		Players:    i.Players,
+	}
+
+	if e.Players == nil {
+		e.Players = []string{}
+	}
+
+	j, _ := json.Marshal(e)
+	err := RedisClient.Do(RedisCtx, RedisClient.B().Publish().Channel(InstanceEventsChannel).Message(string(j)).Build()).Error()
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/rueian/rueidis"
+	"gitlab.com/george/shoya-go/config"
 	"gitlab.com/george/shoya-go/models"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,7 +17,16 @@ var NotFoundErr = errors.New("instance not found")
 
 func getInstance(id string) (*models.WorldInstance, error) {
 	var i *models.WorldInstance
-	err := RedisClient.Do(RedisCtx, RedisClient.B().JsonGet().Key("instances:"+id).Build()).DecodeJSON(&i)
+	var r rueidis.RedisResult
+
+	cmd := RedisClient.B().JsonGet().Key("instances:" + id)
+	if ttl := instanceCacheTtl(); ttl > 0 {
+		r = RedisClient.DoCache(RedisCtx, cmd.Cache(), ttl)
+	} else {
+		r = RedisClient.Do(RedisCtx, cmd.Build())
+	}
+
+	err := r.DecodeJSON(&i)
 	if err != nil {
 		if rueidis.IsRedisNil(err) {
 			return nil, NotFoundErr
@@ -25,14 +38,8 @@ func getInstance(id string) (*models.WorldInstance, error) {
 	return i, nil
 }
 
-func findInstancesForWorldId(worldId, privacy string, includeOverCapacity bool) ([]*models.WorldInstance, error) {
-	var c string
-	if includeOverCapacity {
-		c = "(false|~true)"
-	} else {
-		c = "{false}"
-	}
-	arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index("instanceWorldIdIdx").Query(fmt.Sprintf("@worldId:{%s} @instanceType:{%s} @overCapacity:%s", worldId, privacy, c)).Build()).ToArray()
+func findInstancesPlayerIsIn(playerId string) ([]*models.WorldInstance, error) {
+	arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index("instancePlayersIdx").Query(fmt.Sprintf("@players:{%s}", playerId)).Build()).ToArray()
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
@@ -61,36 +68,208 @@ func findInstancesForWorldId(worldId, privacy string, includeOverCapacity bool)
 	return r, nil
 }
 
-func findInstancesPlayerIsIn(playerId string) ([]*models.WorldInstance, error) {
-	arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index("instancePlayersIdx").Query(fmt.Sprintf("@players:{%s}", playerId)).Build()).ToArray()
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+// searchInstances returns every instance matching the query, paging through the results in batches.
+func searchInstances(index, query string) ([]*models.WorldInstance, error) {
+	var r []*models.WorldInstance
+	var offset int64
+	var batchSize int64 = 100
+
+	for {
+		arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index(index).Query(query).Limit().OffsetNum(offset, batchSize).Build()).ToArray()
+		if err != nil {
+			fmt.Println(err)
+			return nil, err
+		}
+
+		var n int64
+		var p []FtSearchResult
+		n, p, err = parseFtSearch(arr)
+		if err != nil {
+			if err == NotFoundErr {
+				break
+			}
+			fmt.Println(err)
+			return nil, err
+		}
+
+		for _, p := range p {
+			i := &models.WorldInstance{}
+			err = json.Unmarshal([]byte(p.Results["$"]), &i)
+			if err != nil {
+				fmt.Println(err)
+				return nil, err
+			}
+
+			r = append(r, i)
+		}
+
+		if n < batchSize {
+			break
+		}
+		offset += batchSize
 	}
 
-	var n int64
-	var p []FtSearchResult
-	n, p, err = parseFtSearch(arr)
+	return r, nil
+}
+
+// instanceCacheTtl returns the maximum time instances are kept in the client-side cache, or 0 if it is disabled.
+func instanceCacheTtl() time.Duration {
+	return time.Duration(config.RuntimeConfig.Discovery.InstanceCacheTtlMs) * time.Millisecond
+}
+
+// getInstancesForWorldIds looks up the live instances of many worlds at once. Only public instances that are not over
+// capacity are returned in the list of instances, but all instances count towards the occupancy.
+func getInstancesForWorldIds(worldIds []string) (map[string]*models.WorldInstances, error) {
+	var r = make(map[string]*models.WorldInstances, len(worldIds))
+	var is []*models.WorldInstance
+	var err error
+
+	if len(worldIds) == 0 {
+		return r, nil
+	}
+
+	escapedIds := make([]string, len(worldIds))
+	for idx, id := range worldIds {
+		escapedIds[idx] = escapeId(id)
+		r[id] = &models.WorldInstances{
+			Instances: []*models.WorldInstance{},
+			Occupancy: models.WorldOccupancy{WorldID: id},
+		}
+	}
+
+	query := fmt.Sprintf("@worldId:{%s}", strings.Join(escapedIds, "|"))
+	if instanceCacheTtl() > 0 {
+		is, err = searchInstancesCached("instanceWorldIdIdx", query)
+	} else {
+		is, err = searchInstances("instanceWorldIdIdx", query)
+	}
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
-	r := make([]*models.WorldInstance, n)
-	for idx, p := range p {
-		i := &models.WorldInstance{}
-		err = json.Unmarshal([]byte(p.Results["$"]), &i)
+	for _, i := range is {
+		wi, ok := r[i.WorldID]
+		if !ok {
+			continue
+		}
+
+		addToOccupancy(&wi.Occupancy, i)
+		if i.InstanceType == "public" && !i.OverCapacity {
+			wi.Instances = append(wi.Instances, i)
+		}
+	}
+
+	return r, nil
+}
+
+// instanceLookupWorkers is the amount of instances searchInstancesCached looks up at once.
+const instanceLookupWorkers = 16
+
+// searchInstancesCached is like searchInstances, but only retrieves the keys of the matching instances from the index
+// and resolves them through the client-side cache. Up to instanceLookupWorkers lookups are issued concurrently, so that
+// they get pipelined.
+func searchInstancesCached(index, query string) ([]*models.WorldInstance, error) {
+	var ids []string
+	var offset int64
+	var batchSize int64 = 100
+
+	for {
+		arr, err := RedisClient.Do(RedisCtx, RedisClient.B().FtSearch().Index(index).Query(query).Nocontent().Limit().OffsetNum(offset, batchSize).Build()).ToArray()
 		if err != nil {
 			fmt.Println(err)
 			return nil, err
 		}
 
-		r[idx] = i
+		// With NOCONTENT, the reply only consists of the total amount of results followed by the keys.
+		for _, m := range arr[1:] {
+			k, err := m.ToString()
+			if err != nil {
+				fmt.Println(err)
+				return nil, err
+			}
+			ids = append(ids, strings.TrimPrefix(k, "instances:"))
+		}
+
+		if int64(len(arr)-1) < batchSize {
+			break
+		}
+		offset += batchSize
+	}
+
+	var wg sync.WaitGroup
+	var is = make([]*models.WorldInstance, len(ids))
+	var next = make(chan int)
+	for w := 0; w < instanceLookupWorkers && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				i, err := getInstance(ids[idx])
+				if err != nil {
+					continue // The instance may have been removed since we searched for it.
+				}
+				is[idx] = i
+			}
+		}()
+	}
+	for idx := range ids {
+		next <- idx
+	}
+	close(next)
+	wg.Wait()
+
+	var r = make([]*models.WorldInstance, 0, len(is))
+	for _, i := range is {
+		if i != nil {
+			r = append(r, i)
+		}
 	}
 
 	return r, nil
 }
 
+// addToOccupancy adds the players of an instance to the occupancy of its world.
+func addToOccupancy(o *models.WorldOccupancy, i *models.WorldInstance) {
+	o.Occupants += i.PlayerCount.Total
+	if i.InstanceType == "public" {
+		o.PublicOccupants += i.PlayerCount.Total
+	} else {
+		o.PrivateOccupants += i.PlayerCount.Total
+	}
+}
+
+// getActiveWorlds returns the occupancy of every world with at least one player in it, sorted by the amount of players.
+func getActiveWorlds() ([]*models.WorldOccupancy, error) {
+	var r = make([]*models.WorldOccupancy, 0)
+	var worlds = map[string]*models.WorldOccupancy{}
+
+	is, err := searchInstances("instanceWorldIdIdx", "*")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range is {
+		if i.PlayerCount.Total < 1 {
+			continue
+		}
+
+		o, ok := worlds[i.WorldID]
+		if !ok {
+			o = &models.WorldOccupancy{WorldID: i.WorldID}
+			worlds[i.WorldID] = o
+			r = append(r, o)
+		}
+
+		addToOccupancy(o, i)
+	}
+
+	sort.SliceStable(r, func(a, b int) bool {
+		return r[a].Occupants > r[b].Occupants
+	})
+
+	return r, nil
+}
+
 // registerInstance registers a WorldInstance into Redis
 func registerInstance(id, locationString, worldId, instanceType, ownerId string, capacity int) (*models.WorldInstance, error) {
 	i := &models.WorldInstance{
@@ -146,6 +325,18 @@ func addPlayer(instanceId, playerId string) error {
 
 // removePlayer removes a player from a WorldInstance in Redis
 func removePlayer(instanceId, playerId string) error {
+	err := removePlayerEntry(instanceId, playerId)
+	if err != nil {
+		return err
+	}
+
+	err = RedisClient.Do(RedisCtx, RedisClient.B().JsonSet().Key("instances:"+instanceId).Path(".lastPing").Value(fmt.Sprintf("%d", time.Now().Unix())).Build()).Error()
+
+	return err
+}
+
+// removePlayerEntry removes a player from the player list of a WorldInstance in Redis without refreshing its lastPing.
+func removePlayerEntry(instanceId, playerId string) error {
 	playerId = fmt.Sprintf("\"%s\"", playerId)
 	i, err := RedisClient.Do(RedisCtx, RedisClient.B().JsonArrindex().Key("instances:"+instanceId).Path(".players").Value(playerId).Build()).ToInt64()
 	if err != nil {
@@ -153,6 +344,10 @@ func removePlayer(instanceId, playerId string) error {
 		return err
 	}
 
+	if i < 0 {
+		return nil
+	}
+
 	err = RedisClient.Do(RedisCtx, RedisClient.B().JsonArrpop().Key("instances:"+instanceId).Path(".players").Index(i).Build()).Error()
 	if err != nil {
 		fmt.Println(err)
@@ -165,7 +360,5 @@ func removePlayer(instanceId, playerId string) error {
 		return err
 	}
 
-	err = RedisClient.Do(RedisCtx, RedisClient.B().JsonSet().Key("instances:"+instanceId).Path(".lastPing").Value(fmt.Sprintf("%d", time.Now().Unix())).Build()).Error()
-
-	return err
+	return nil
 }
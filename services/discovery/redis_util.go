@@ -20,11 +20,8 @@ func parseFtSearch(ms []rueidis.RedisMessage) (int64, []FtSearchResult, error) {
 		return 0, nil, NotFoundErr
 	}
 
-	if count > 10 { // FIXME(george): Discovery should be able to handle over ten results via paging (although this should never be required)
-		count = 10
-	}
-
-	r := make([]FtSearchResult, count)
+	// count is the total amount of matching documents, which may exceed the amount of documents returned (LIMIT).
+	r := make([]FtSearchResult, (len(ms)-1)/2)
 
 	cur := 0
 	for i := 1; i < len(ms); {
@@ -40,7 +37,7 @@ func parseFtSearch(ms []rueidis.RedisMessage) (int64, []FtSearchResult, error) {
 		i += 2
 	}
 
-	return count, r, nil
+	return int64(len(r)), r, nil
 }
 
 func escapeId(s string) string {
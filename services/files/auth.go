@@ -0,0 +1,110 @@
+package files
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gitlab.com/george/shoya-go/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// serverOptions returns the options the gRPC server is created with, based on the TLS & authentication configuration.
+func serverOptions() ([]grpc.ServerOption, error) {
+	var opts []grpc.ServerOption
+	c := config.RuntimeConfig.Files.GrpcSvcConfig
+
+	if c.Tls.CertFile != "" {
+		t, err := serverTlsConfig(c.Tls)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(t)))
+	} else {
+		log.Printf("[%v] [Main] [WARN]: serving without TLS; set files.tls.certFile to encrypt the channel", time.Now())
+	}
+
+	if c.AuthToken != "" {
+		opts = append(opts, grpc.UnaryInterceptor(tokenUnaryInterceptor(c.AuthToken)))
+	} else if c.Tls.ClientCaFile == "" {
+		log.Printf("[%v] [Main] [WARN]: neither authToken nor tls.clientCaFile is set; any caller can use the service", time.Now())
+	}
+
+	return opts, nil
+}
+
+// serverTlsConfig loads the certificate of the service and, if a client CA is configured, requires clients to present
+// a certificate signed by it.
+func serverTlsConfig(c config.GrpcTlsSvcConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tls certificate: %w", err)
+	}
+
+	t := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientCaFile != "" {
+		pem, err := os.ReadFile(c.ClientCaFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls client ca: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("error reading tls client ca: no certificates found")
+		}
+
+		t.ClientCAs = pool
+		t.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return t, nil
+}
+
+// tokenUnaryInterceptor rejects calls that do not present the token as a bearer token in their `authorization`
+// metadata. The standard health service is exempt, so that orchestrators can probe the service.
+func tokenUnaryInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+			return handler(ctx, req)
+		}
+
+		if !validToken(ctx, token) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing auth token")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// validToken checks whether the incoming metadata of the context carries the token.
+func validToken(ctx context.Context, token string) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, v := range md.Get("authorization") {
+		t := strings.TrimPrefix(v, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,35 +2,45 @@ package files
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/gtsatsis/harvester"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"gitlab.com/george/shoya-go/config"
 	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"gitlab.com/george/shoya-go/migrations"
+	"gitlab.com/george/shoya-go/models"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+	"io"
 	"log"
 	"net"
-	"net/http"
-	"net/url"
-	"strings"
 	"time"
 )
 
-var MinioClient *minio.Core
-
 type server struct {
 	pb.UnimplementedFileServer
 }
 
 func Main() {
-	initializeRedis()
-	initializeApiConfig()
-	initMinioClient()
+	if err := config.RuntimeConfig.Require("files"); err != nil {
+		log.Fatalf("error reading config: %v", err)
+	}
+
+	initialize()
+
+	if l, ok := Storage.(*localStorage); ok {
+		go l.Serve(config.RuntimeConfig.Files.Storage.LocalListenAddress)
+	}
 
-	if config.RuntimeConfig.Files == nil {
-		log.Fatalf("error reading config: RuntimeConfig.Files was nil")
+	if config.RuntimeConfig.Files.GcIntervalMinutes > 0 {
+		go periodicGc(time.Duration(config.RuntimeConfig.Files.GcIntervalMinutes) * time.Minute)
 	}
 
 	lis, err := net.Listen("tcp", config.RuntimeConfig.Files.ListenAddress)
@@ -38,14 +48,31 @@ func Main() {
 		panic(err)
 	}
 
-	s := grpc.NewServer()
+	opts, err := serverOptions()
+	if err != nil {
+		log.Fatalf("error configuring grpc server: %v", err)
+	}
+
+	s := grpc.NewServer(opts...)
 	pb.RegisterFileServer(s, &server{})
 
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	go monitorHealth(hs)
+
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
 
+// initialize sets up everything the files service depends on.
+func initialize() {
+	initializeRedis()
+	initializeApiConfig()
+	initializeDB()
+	initStorage()
+}
+
 // initializeRedis initializes the redis clients
 func initializeRedis() {
 	config.HarvestRedisClient = redis.NewClient(&redis.Options{
@@ -60,6 +87,27 @@ func initializeRedis() {
 	}
 }
 
+// initializeDB initializes the database connection, refusing to start if the schema has not been migrated.
+func initializeDB() {
+	var err error
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Etc/GMT",
+		config.RuntimeConfig.Files.Postgres.Host,
+		config.RuntimeConfig.Files.Postgres.User,
+		config.RuntimeConfig.Files.Postgres.Password,
+		config.RuntimeConfig.Files.Postgres.Database,
+		config.RuntimeConfig.Files.Postgres.Port)
+	config.DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Silent),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if err = migrations.Check(config.DB); err != nil {
+		log.Fatalf("refusing to start: %v (run `shoya db migrate up` first)", err)
+	}
+}
+
 // initializeApiConfig initializes harvester client used to configure the API
 func initializeApiConfig() {
 	h, err := harvester.New(&config.ApiConfiguration).
@@ -77,45 +125,165 @@ func initializeApiConfig() {
 }
 
 func (s *server) GetFile(ctx context.Context, in *pb.GetFileRequest) (*pb.GetFileResponse, error) {
-	headers := http.Header{}
-	f, err := MinioClient.PresignHeader(context.TODO(), http.MethodGet, config.ApiConfiguration.FilesS3Bucket.Get(), in.GetName(), time.Minute*5, make(url.Values), headers)
+	expiry := urlExpiry()
+	expiresAt := time.Now().Add(expiry).Unix()
+	fileUrl, err := Storage.PresignGet(context.TODO(), in.GetName(), expiry)
 	if err != nil {
 		log.Printf("[%v] [GetFile] [ERROR]: %v", time.Now(), err)
 		return nil, err
 	}
 
-	fileUrl := f.String()
-	return &pb.GetFileResponse{Url: &fileUrl}, nil
+	return &pb.GetFileResponse{Url: &fileUrl, ExpiresAt: &expiresAt}, nil
+}
+
+// urlExpiry returns how long presigned download urls stay valid for.
+func urlExpiry() time.Duration {
+	if s := config.ApiConfiguration.FilesUrlExpirySeconds.Get(); s > 0 {
+		return time.Duration(s) * time.Second
+	}
+
+	return 5 * time.Minute
 }
 
 func (s *server) CreateFile(ctx context.Context, in *pb.CreateFileRequest) (*pb.CreateFileResponse, error) {
-	headers := http.Header{}
-	headers.Add("Content-MD5", in.GetMd5())
-	u, err := MinioClient.PresignHeader(context.TODO(), http.MethodPut, config.ApiConfiguration.FilesS3Bucket.Get(), in.GetName(), time.Hour*3, url.Values{}, headers)
+	uploadUrl, err := Storage.PresignPut(context.TODO(), in.GetName(), in.GetMd5(), in.GetContentType(), time.Hour*3)
 	if err != nil {
 		log.Printf("[%v] [CreateFile] [ERROR]: %v", time.Now(), err)
 		return nil, err
 	}
-	uploadUrl := u.String()
+
 	return &pb.CreateFileResponse{Url: &uploadUrl}, nil
 }
 
-func (s *server) HealthCheck(ctx context.Context, in *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+func (s *server) CreateMultipartUpload(ctx context.Context, in *pb.CreateMultipartUploadRequest) (*pb.CreateMultipartUploadResponse, error) {
+	uploadId, err := Storage.CreateMultipartUpload(context.TODO(), in.GetName(), in.GetContentType())
+	if err != nil {
+		log.Printf("[%v] [CreateMultipartUpload] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
+	return &pb.CreateMultipartUploadResponse{UploadId: &uploadId}, nil
+}
+
+func (s *server) GetPartUploadUrl(ctx context.Context, in *pb.GetPartUploadUrlRequest) (*pb.GetPartUploadUrlResponse, error) {
+	uploadUrl, err := Storage.PresignPart(context.TODO(), in.GetName(), in.GetUploadId(), int(in.GetPartNumber()), time.Hour*3)
+	if err != nil {
+		log.Printf("[%v] [GetPartUploadUrl] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
+	return &pb.GetPartUploadUrlResponse{Url: &uploadUrl}, nil
+}
+
+func (s *server) CompleteMultipartUpload(ctx context.Context, in *pb.CompleteMultipartUploadRequest) (*pb.CompleteMultipartUploadResponse, error) {
+	etag, err := Storage.CompleteMultipartUpload(context.TODO(), in.GetName(), in.GetUploadId(), in.GetEtags())
+	if err != nil {
+		log.Printf("[%v] [CompleteMultipartUpload] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
+	return &pb.CompleteMultipartUploadResponse{Etag: &etag}, nil
+}
+
+func (s *server) AbortMultipartUpload(ctx context.Context, in *pb.AbortMultipartUploadRequest) (*pb.AbortMultipartUploadResponse, error) {
+	err := Storage.AbortMultipartUpload(context.TODO(), in.GetName(), in.GetUploadId())
+	if err != nil {
+		log.Printf("[%v] [AbortMultipartUpload] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
 	ok := true
-	return &pb.HealthCheckResponse{Ok: &ok}, nil
+	return &pb.AbortMultipartUploadResponse{Ok: &ok}, nil
 }
 
-func initMinioClient() {
-	var endpointUrl = config.ApiConfiguration.FilesS3Endpoint.Get()
-	var endpointIsSecure = strings.Contains(endpointUrl, "https://")
-	var endpoint = strings.ReplaceAll(strings.ReplaceAll(endpointUrl, "https://", ""), "http://", "")
-	var err error
-	// Initialize minio client object.
-	MinioClient, err = minio.NewCore(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.ApiConfiguration.FilesS3AccessKey.Get(), config.ApiConfiguration.FilesS3SecretKey.Get(), ""),
-		Secure: endpointIsSecure,
-	})
+func (s *server) StatFile(ctx context.Context, in *pb.StatFileRequest) (*pb.StatFileResponse, error) {
+	var exists bool
+	var size int64
+	var etag string
+
+	o, err := Storage.Stat(context.TODO(), in.GetName())
 	if err != nil {
-		log.Fatalln(err)
+		if err != ErrObjectNotFound {
+			log.Printf("[%v] [StatFile] [ERROR]: %v", time.Now(), err)
+			return nil, err
+		}
+	} else {
+		exists = true
+		size = o.Size
+		etag = o.ETag
+	}
+
+	return &pb.StatFileResponse{Exists: &exists, Size: &size, Etag: &etag}, nil
+}
+
+func (s *server) DeleteFile(ctx context.Context, in *pb.DeleteFileRequest) (*pb.DeleteFileResponse, error) {
+	err := Storage.Delete(context.TODO(), in.GetName())
+	if err != nil {
+		log.Printf("[%v] [DeleteFile] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
+	// Variants that fail to be deleted here are picked up by the garbage collection.
+	for _, w := range models.ImageVariantWidths {
+		for format := range imageFormats {
+			if err = Storage.Delete(context.TODO(), imageVariantName(in.GetName(), w, format)); err != nil {
+				log.Printf("[%v] [DeleteFile] [ERROR]: %v", time.Now(), err)
+			}
+		}
+	}
+
+	ok := true
+	return &pb.DeleteFileResponse{Ok: &ok}, nil
+}
+
+func (s *server) GetImage(ctx context.Context, in *pb.GetImageRequest) (*pb.GetImageResponse, error) {
+	width, format := int(in.GetWidth()), in.GetFormat()
+	if err := validateImageVariant(width, format); err != nil {
+		return nil, err
 	}
+
+	variant := imageVariantName(in.GetName(), width, format)
+	_, err := Storage.Stat(context.TODO(), variant)
+	if err == ErrObjectNotFound {
+		err = generateImageVariant(context.TODO(), in.GetName(), variant, width, format)
+	}
+	if err != nil {
+		log.Printf("[%v] [GetImage] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
+	expiry := urlExpiry()
+	expiresAt := time.Now().Add(expiry).Unix()
+	imageUrl, err := Storage.PresignGet(context.TODO(), variant, expiry)
+	if err != nil {
+		log.Printf("[%v] [GetImage] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
+	return &pb.GetImageResponse{Url: &imageUrl, ExpiresAt: &expiresAt, Name: &variant}, nil
+}
+
+func (s *server) HashFile(ctx context.Context, in *pb.HashFileRequest) (*pb.HashFileResponse, error) {
+	r, err := Storage.Open(ctx, in.GetName())
+	if err != nil {
+		log.Printf("[%v] [HashFile] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	m := md5.New()
+	if _, err = io.Copy(io.MultiWriter(h, m), r); err != nil {
+		log.Printf("[%v] [HashFile] [ERROR]: %v", time.Now(), err)
+		return nil, err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	md5sum := hex.EncodeToString(m.Sum(nil))
+	return &pb.HashFileResponse{Sha256: &sum, Md5: &md5sum}, nil
+}
+
+func (s *server) HealthCheck(ctx context.Context, in *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	ok, components := checkHealth()
+	return &pb.HealthCheckResponse{Ok: &ok, Components: components}, nil
 }
@@ -0,0 +1,127 @@
+// Package files_client transfers the contents of objects through the presigned urls handed out by the files service,
+// for tools that have no client uploading or downloading on their behalf (e.g.: `shoya init` & `shoya backup`).
+package files_client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"gitlab.com/george/shoya-go/models"
+	"io"
+	"net/http"
+)
+
+// Upload uploads the size bytes of r to the object, in parts of models.FileMultipartUploadThreshold if it is larger
+// than that. md5 is the base64-encoded MD5 of the contents, which single-part uploads are verified against. The ETags
+// of the parts are returned for multipart uploads.
+func Upload(ctx context.Context, fc pb.FileClient, name string, r io.ReaderAt, size int64, md5, contentType string) ([]string, error) {
+	if size <= models.FileMultipartUploadThreshold {
+		u, err := fc.CreateFile(ctx, &pb.CreateFileRequest{Name: &name, Md5: &md5, ContentType: &contentType})
+		if err != nil {
+			return nil, err
+		}
+
+		header := http.Header{"Content-MD5": {md5}, "Content-Type": {contentType}}
+		_, err = put(ctx, u.GetUrl(), io.NewSectionReader(r, 0, size), header)
+		return nil, err
+	}
+
+	mu, err := fc.CreateMultipartUpload(ctx, &pb.CreateMultipartUploadRequest{Name: &name, ContentType: &contentType})
+	if err != nil {
+		return nil, err
+	}
+
+	abort := func() {
+		_, _ = fc.AbortMultipartUpload(ctx, &pb.AbortMultipartUploadRequest{Name: &name, UploadId: mu.UploadId})
+	}
+
+	var etags []string
+	for offset := int64(0); offset < size; offset += models.FileMultipartUploadThreshold {
+		pn := int32(len(etags) + 1)
+		p, err := fc.GetPartUploadUrl(ctx, &pb.GetPartUploadUrlRequest{Name: &name, UploadId: mu.UploadId, PartNumber: &pn})
+		if err != nil {
+			abort()
+			return nil, err
+		}
+
+		n := size - offset
+		if n > models.FileMultipartUploadThreshold {
+			n = models.FileMultipartUploadThreshold
+		}
+
+		etag, err := put(ctx, p.GetUrl(), io.NewSectionReader(r, offset, n), nil)
+		if err != nil {
+			abort()
+			return nil, fmt.Errorf("part %d: %w", pn, err)
+		}
+
+		etags = append(etags, etag)
+	}
+
+	if _, err = fc.CompleteMultipartUpload(ctx, &pb.CompleteMultipartUploadRequest{Name: &name, UploadId: mu.UploadId, Etags: etags}); err != nil {
+		return nil, err
+	}
+
+	return etags, nil
+}
+
+// Download writes the contents of the object to w, and returns how many bytes were written.
+func Download(ctx context.Context, fc pb.FileClient, name string, w io.Writer) (int64, error) {
+	u, err := fc.GetFile(ctx, &pb.GetFileRequest{Name: &name})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.GetUrl(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if err = checkResponse(res); err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+
+	return io.Copy(w, res.Body)
+}
+
+// put uploads the body to a presigned url, and returns the ETag of the uploaded object (or part).
+func put(ctx context.Context, url string, body *io.SectionReader, header http.Header) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, body)
+	if err != nil {
+		return "", err
+	}
+
+	req.ContentLength = body.Size()
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if err = checkResponse(res); err != nil {
+		return "", fmt.Errorf("upload failed: %w", err)
+	}
+
+	return res.Header.Get("ETag"), nil
+}
+
+// checkResponse returns an error containing the start of the body if the response does not have a 2xx status.
+func checkResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("status %d: %s", res.StatusCode, bytes.TrimSpace(b))
+}
@@ -0,0 +1,420 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"gitlab.com/george/shoya-go/config"
+	"gitlab.com/george/shoya-go/models"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"time"
+)
+
+const gcLockKey = "files:gc:lock"
+
+// gcLockId uniquely identifies this process when holding the garbage collection lock.
+var gcLockId = uuid.NewString()
+
+// gcUnlockScript releases the garbage collection lock, but only if it is still held by this process.
+var gcUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// descriptorIsReferenced is the condition matching descriptors that are used by a (non-deleted) file version.
+const descriptorIsReferenced = `EXISTS (SELECT 1 FROM file_versions fv WHERE fv.deleted_at IS NULL AND file_descriptors.id IN (fv.file_descriptor_id, fv.delta_descriptor_id, fv.signature_descriptor_id))`
+
+// referencedFileIds is a subquery returning the ids of all files that are used by an avatar or a world.
+const referencedFileIds = `SELECT file_id FROM world_unity_packages UNION SELECT file_id FROM avatar_unity_packages UNION SELECT image_id FROM worlds UNION SELECT image_id FROM avatars`
+
+// gcReport lists everything that was (or, in a dry run, would have been) collected.
+type gcReport struct {
+	DryRun               bool
+	OrphanedObjects      []*ObjectInfo           // Objects (& image variants) with no live descriptor.
+	StuckVersions        []models.FileVersion    // Versions whose upload was never finished.
+	UnreferencedVersions []models.FileVersion    // Older versions of files which are no longer used by any avatar or world.
+	DanglingDescriptors  []models.FileDescriptor // Descriptors which no longer belong to a version (e.g.: of deleted files).
+}
+
+// GcMain garbage collects orphaned files once, or every interval if it is non-zero, and prints what was collected.
+func GcMain(dryRun bool, interval time.Duration) {
+	if err := config.RuntimeConfig.Require("files"); err != nil {
+		log.Fatalf("error reading config: %v", err)
+	}
+
+	initialize()
+
+	for {
+		r, err := runGc(dryRun, gcGracePeriod())
+		if err != nil {
+			log.Printf("[%v] [GC] [ERROR]: %v", time.Now(), err)
+		} else {
+			r.Render()
+		}
+
+		if interval == 0 {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+// periodicGc garbage collects orphaned files every interval while the service runs.
+func periodicGc(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		r, err := runGc(false, gcGracePeriod())
+		if err != nil {
+			log.Printf("[%v] [GC] [ERROR]: %v", time.Now(), err)
+			continue
+		}
+
+		if r != nil {
+			log.Printf("[%v] [GC]: %s", time.Now(), r.Summary())
+		}
+	}
+}
+
+// gcGracePeriod returns the configured grace period, falling back to the default (24h) if unset.
+func gcGracePeriod() time.Duration {
+	if m := config.RuntimeConfig.Files.GcGracePeriodMinutes; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+
+	return 24 * time.Hour
+}
+
+// runGc runs the garbage collection while holding the lock, so only one replica collects at any given time. A nil
+// report is returned if another replica is already collecting.
+func runGc(dryRun bool, grace time.Duration) (*gcReport, error) {
+	ok, err := config.HarvestRedisClient.SetNX(context.Background(), gcLockKey, gcLockId, time.Hour).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		log.Printf("[%v] [GC]: another garbage collection is already running, skipping", time.Now())
+		return nil, nil
+	}
+	defer gcUnlockScript.Run(context.Background(), config.HarvestRedisClient, []string{gcLockKey}, gcLockId)
+
+	return collectGarbage(dryRun, time.Now().Add(-grace))
+}
+
+// collectGarbage collects everything that was last modified before the cutoff. Versions & descriptors are collected
+// first, so that the objects they leave behind are picked up by the orphaned object scan in the same run.
+func collectGarbage(dryRun bool, cutoff time.Time) (*gcReport, error) {
+	var err error
+	var r = &gcReport{DryRun: dryRun}
+
+	if r.StuckVersions, err = findStuckVersions(cutoff); err != nil {
+		return nil, err
+	}
+
+	if r.UnreferencedVersions, err = findUnreferencedVersions(cutoff); err != nil {
+		return nil, err
+	}
+
+	if err = config.DB.Where("NOT "+descriptorIsReferenced+" AND updated_at < ?", cutoff.Unix()).Find(&r.DanglingDescriptors).Error; err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		for _, v := range append(r.StuckVersions, r.UnreferencedVersions...) {
+			if err = deleteFileVersion(&v); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, fd := range r.DanglingDescriptors {
+			if err = deleteDescriptor(&fd); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if r.OrphanedObjects, err = findOrphanedObjects(dryRun, cutoff); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// findStuckVersions returns the versions which are still waiting for their upload to be finished, and neither they nor
+// their descriptors have been touched since the cutoff.
+func findStuckVersions(cutoff time.Time) ([]models.FileVersion, error) {
+	var versions []models.FileVersion
+	var stuck []models.FileVersion
+
+	err := config.DB.Preload("FileDescriptor").
+		Preload("DeltaDescriptor").
+		Preload("SignatureDescriptor").
+		Where("status = ? AND updated_at < ?", models.FileUploadStatusWaiting, cutoff.Unix()).
+		Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.FileDescriptor.UpdatedAt < cutoff.Unix() && v.DeltaDescriptor.UpdatedAt < cutoff.Unix() && v.SignatureDescriptor.UpdatedAt < cutoff.Unix() {
+			stuck = append(stuck, v)
+		}
+	}
+
+	return stuck, nil
+}
+
+// findUnreferencedVersions returns the complete versions of files used by avatars & worlds, that are neither the latest
+// (complete) version of their file, nor pinned by a unity package.
+func findUnreferencedVersions(cutoff time.Time) ([]models.FileVersion, error) {
+	var versions []models.FileVersion
+	var pinned []struct {
+		FileID      string
+		FileVersion int
+	}
+	var keep = map[string]map[int]bool{}
+	var unreferenced []models.FileVersion
+
+	err := config.DB.Preload("FileDescriptor").
+		Preload("DeltaDescriptor").
+		Preload("SignatureDescriptor").
+		Where("file_id IN (" + referencedFileIds + ")").
+		Order("version").
+		Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.DB.Raw("SELECT file_id, file_version FROM world_unity_packages UNION SELECT file_id, file_version FROM avatar_unity_packages").
+		Scan(&pinned).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pinned {
+		if keep[p.FileID] == nil {
+			keep[p.FileID] = map[int]bool{}
+		}
+		keep[p.FileID][p.FileVersion] = true
+	}
+
+	// Versions are ordered, so the last one seen for each file is the latest.
+	var latest = map[string]int{}
+	var latestComplete = map[string]int{}
+	for _, v := range versions {
+		latest[v.FileID] = v.Version
+		if v.Status == models.FileUploadStatusComplete {
+			latestComplete[v.FileID] = v.Version
+		}
+	}
+
+	for _, v := range versions {
+		if v.Version == 0 || v.Status != models.FileUploadStatusComplete || v.UpdatedAt >= cutoff.Unix() {
+			continue
+		}
+
+		if v.Version == latest[v.FileID] || v.Version == latestComplete[v.FileID] || keep[v.FileID][v.Version] {
+			continue
+		}
+
+		unreferenced = append(unreferenced, v)
+	}
+
+	return unreferenced, nil
+}
+
+// findOrphanedObjects returns (& deletes, unless dryRun is set) the stored objects that were last modified before the
+// cutoff & do not belong to any live descriptor.
+func findOrphanedObjects(dryRun bool, cutoff time.Time) ([]*ObjectInfo, error) {
+	var names []string
+	var objects []string
+	var live = map[string]bool{}
+	var orphaned []*ObjectInfo
+
+	if err := config.DB.Model(&models.FileDescriptor{}).Where(descriptorIsReferenced).Pluck("COALESCE(NULLIF(object_name, ''), file_name)", &names).Error; err != nil {
+		return nil, err
+	}
+
+	// Objects that are still referenced are never collected, even if their descriptors are (somehow) gone.
+	if err := config.DB.Model(&models.FileObject{}).Where("reference_count > 0").Pluck("name", &objects).Error; err != nil {
+		return nil, err
+	}
+
+	for _, n := range append(names, objects...) {
+		live[n] = true
+	}
+
+	err := Storage.List(context.Background(), func(o *ObjectInfo) error {
+		// Image variants live as long as the image they were generated from.
+		if live[o.Name] || live[imageVariantSource(o.Name)] || o.LastModified.After(cutoff) {
+			return nil
+		}
+
+		orphaned = append(orphaned, o)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		for _, o := range orphaned {
+			if err = Storage.Delete(context.Background(), o.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return orphaned, nil
+}
+
+// deleteFileVersion deletes the version & its descriptors, followed by the objects that are no longer referenced.
+func deleteFileVersion(v *models.FileVersion) error {
+	var ids []string
+	var objects []string
+
+	tx := config.DB.Begin()
+	for _, fd := range []models.FileDescriptor{v.FileDescriptor, v.DeltaDescriptor, v.SignatureDescriptor} {
+		if fd.ID == "" {
+			continue
+		}
+		ids = append(ids, fd.ID)
+
+		object, err := releaseDescriptorObject(tx, &fd)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if object != "" {
+			objects = append(objects, object)
+		}
+	}
+
+	if err := tx.Unscoped().Delete(v).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if len(ids) != 0 {
+		if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.FileDescriptor{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	deleteObjects(objects)
+	return nil
+}
+
+// deleteDescriptor deletes a descriptor, followed by its object if it is no longer referenced.
+func deleteDescriptor(fd *models.FileDescriptor) error {
+	tx := config.DB.Begin()
+	object, err := releaseDescriptorObject(tx, fd)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Unscoped().Delete(fd).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+
+	if object != "" {
+		deleteObjects([]string{object})
+	}
+	return nil
+}
+
+// releaseDescriptorObject aborts the multipart upload of a descriptor (if it is still in progress) & releases its
+// reference to the object holding its contents. The name of the object is returned if it should be deleted.
+func releaseDescriptorObject(tx *gorm.DB, fd *models.FileDescriptor) (string, error) {
+	if fd.FileName == "" {
+		return "", nil
+	}
+
+	// Incomplete descriptors do not reference a shared object, but may have (partially) uploaded their own.
+	if fd.Status != models.FileUploadStatusComplete {
+		if fd.UploadId != "" {
+			if err := Storage.AbortMultipartUpload(context.Background(), fd.FileName, fd.UploadId); err != nil {
+				log.Printf("[%v] [GC] [ERROR]: failed to abort upload %s of %s: %v", time.Now(), fd.UploadId, fd.FileName, err)
+			}
+		}
+
+		return fd.FileName, nil
+	}
+
+	last, err := models.ReleaseFileObject(tx, fd)
+	if err != nil || !last {
+		return "", err
+	}
+
+	return fd.GetObjectName(), nil
+}
+
+// deleteObjects deletes the objects from storage. Objects that fail to be deleted are picked up by the next run.
+func deleteObjects(objects []string) {
+	for _, o := range objects {
+		if err := Storage.Delete(context.Background(), o); err != nil {
+			log.Printf("[%v] [GC] [ERROR]: failed to delete %s: %v", time.Now(), o, err)
+		}
+	}
+}
+
+// Summary returns a one-line summary of the report.
+func (r *gcReport) Summary() string {
+	var size int64
+	for _, o := range r.OrphanedObjects {
+		size += o.Size
+	}
+
+	verb := "collected"
+	if r.DryRun {
+		verb = "would collect"
+	}
+
+	return fmt.Sprintf("%s %d orphaned objects (%d bytes), %d stuck versions, %d unreferenced versions & %d dangling descriptors",
+		verb, len(r.OrphanedObjects), size, len(r.StuckVersions), len(r.UnreferencedVersions), len(r.DanglingDescriptors))
+}
+
+// Render prints the report as a table.
+func (r *gcReport) Render() {
+	tb := table.NewWriter()
+	tb.SetOutputMirror(os.Stdout)
+	tb.AppendHeader(table.Row{"Kind", "Name", "Size", "Last Modified"})
+
+	for _, v := range r.StuckVersions {
+		tb.AppendRow(table.Row{"stuck version", fmt.Sprintf("%s/%d", v.FileID, v.Version), v.FileDescriptor.SizeInBytes, time.Unix(v.UpdatedAt, 0).UTC().Format(time.RFC3339)})
+	}
+
+	for _, v := range r.UnreferencedVersions {
+		tb.AppendRow(table.Row{"unreferenced version", fmt.Sprintf("%s/%d", v.FileID, v.Version), v.FileDescriptor.SizeInBytes, time.Unix(v.UpdatedAt, 0).UTC().Format(time.RFC3339)})
+	}
+
+	for _, fd := range r.DanglingDescriptors {
+		tb.AppendRow(table.Row{"dangling descriptor", fd.FileName, fd.SizeInBytes, time.Unix(fd.UpdatedAt, 0).UTC().Format(time.RFC3339)})
+	}
+
+	for _, o := range r.OrphanedObjects {
+		tb.AppendRow(table.Row{"orphaned object", o.Name, o.Size, o.LastModified.UTC().Format(time.RFC3339)})
+	}
+
+	tb.AppendFooter(table.Row{"", r.Summary()})
+	tb.Render()
+}
@@ -0,0 +1,132 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"gitlab.com/george/shoya-go/config"
+	pb "gitlab.com/george/shoya-go/gen/v1/proto"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"log"
+	"sync"
+	"time"
+)
+
+// healthCheckObjectName is the object written & deleted to check that the storage backend can be written to. It is
+// unique to every instance of the service, so that concurrent checks do not interfere with each other.
+var healthCheckObjectName = ".healthcheck-" + uuid.New().String()
+
+// healthCheckTimeout is how long all checks may take in total.
+const healthCheckTimeout = 10 * time.Second
+
+// healthCache holds the result of the last health check, which is reused until it is older than healthCacheTtl.
+var healthCache struct {
+	sync.Mutex
+	checkedAt  time.Time
+	ok         bool
+	components []*pb.ComponentStatus
+}
+
+// healthCacheTtl returns how long the result of a health check is reused for.
+func healthCacheTtl() time.Duration {
+	if s := config.RuntimeConfig.Files.HealthCheckCacheSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+
+	return 30 * time.Second
+}
+
+// checkHealth returns whether the service is healthy along with the status of each of its components. Results are
+// cached, so that frequent probes do not write to the storage backend every time.
+func checkHealth() (bool, []*pb.ComponentStatus) {
+	healthCache.Lock()
+	defer healthCache.Unlock()
+
+	if time.Since(healthCache.checkedAt) < healthCacheTtl() {
+		return healthCache.ok, healthCache.components
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	storageErr := Storage.Ping(ctx)
+	writeErr := storageErr
+	if storageErr == nil {
+		writeErr = checkStorageWritable(ctx)
+	}
+
+	components := []*pb.ComponentStatus{
+		componentStatus("storage", storageErr),
+		componentStatus("storage_write", writeErr),
+		componentStatus("postgres", checkPostgres(ctx)),
+		componentStatus("redis", config.HarvestRedisClient.Ping(ctx).Err()),
+	}
+
+	ok := true
+	for _, c := range components {
+		if !c.GetOk() {
+			ok = false
+			log.Printf("[%v] [HealthCheck] [ERROR]: %s: %s", time.Now(), c.GetName(), c.GetError())
+		}
+	}
+
+	healthCache.checkedAt = time.Now()
+	healthCache.ok = ok
+	healthCache.components = components
+
+	return ok, components
+}
+
+// checkStorageWritable writes a small object to the storage backend & deletes it again.
+func checkStorageWritable(ctx context.Context) error {
+	b := []byte("ok")
+	if err := Storage.Put(ctx, healthCheckObjectName, bytes.NewReader(b), int64(len(b)), "text/plain"); err != nil {
+		return err
+	}
+
+	return Storage.Delete(ctx, healthCheckObjectName)
+}
+
+// checkPostgres pings the database.
+func checkPostgres(ctx context.Context) error {
+	if config.DB == nil {
+		return errors.New("database not initialized")
+	}
+
+	db, err := config.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.PingContext(ctx)
+}
+
+// componentStatus returns the status of the component based on the error its check returned.
+func componentStatus(name string, err error) *pb.ComponentStatus {
+	ok := err == nil
+	checkedAt := time.Now().Unix()
+	s := &pb.ComponentStatus{Name: &name, Ok: &ok, CheckedAt: &checkedAt}
+	if err != nil {
+		e := err.Error()
+		s.Error = &e
+	}
+
+	return s
+}
+
+// monitorHealth keeps the status reported by the standard gRPC health service up-to-date, both for the server as a
+// whole ("") and for the File service.
+func monitorHealth(hs *health.Server) {
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if ok, _ := checkHealth(); !ok {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		hs.SetServingStatus("", status)
+		hs.SetServingStatus(pb.File_ServiceDesc.ServiceName, status)
+		time.Sleep(healthCacheTtl())
+	}
+}
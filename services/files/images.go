@@ -0,0 +1,160 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.com/george/shoya-go/models"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+)
+
+// maxImageSize is the maximum size (in bytes) of images that variants are generated for.
+const maxImageSize = 32 * 1024 * 1024
+
+// maxImagePixels is the maximum amount of pixels of images that variants are generated for.
+const maxImagePixels = 8192 * 8192
+
+var ErrInvalidImageWidth = errors.New("invalid image width")
+var ErrInvalidImageFormat = errors.New("invalid image format")
+var ErrImageTooLarge = errors.New("image too large")
+
+// imageFormats maps the formats variants can be generated in to their extension & content type.
+var imageFormats = map[string]struct {
+	Extension   string
+	ContentType string
+}{
+	"png":  {"png", "image/png"},
+	"jpeg": {"jpg", "image/jpeg"},
+}
+
+var imageVariantRegex = regexp.MustCompile(`^(.+)\.\d+w\.(png|jpg)$`)
+
+// imageVariantName returns the name of the variant of the image resized to the width, in the format.
+func imageVariantName(name string, width int, format string) string {
+	return fmt.Sprintf("%s.%dw.%s", name, width, imageFormats[format].Extension)
+}
+
+// imageVariantSource returns the name of the image the object is a variant of, or an empty string if it is not one.
+func imageVariantSource(name string) string {
+	m := imageVariantRegex.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+
+	return m[1]
+}
+
+// validateImageVariant checks whether variants are generated in the width & format.
+func validateImageVariant(width int, format string) error {
+	if _, ok := imageFormats[format]; !ok {
+		return ErrInvalidImageFormat
+	}
+
+	for _, w := range models.ImageVariantWidths {
+		if w == width {
+			return nil
+		}
+	}
+
+	return ErrInvalidImageWidth
+}
+
+// generateImageVariant resizes the image to the width (never upscaling it), encodes it in the format, and stores it as
+// the variant.
+func generateImageVariant(ctx context.Context, name, variant string, width int, format string) error {
+	r, err := Storage.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, maxImageSize+1))
+	if err != nil {
+		return err
+	}
+
+	if len(b) > maxImageSize {
+		return ErrImageTooLarge
+	}
+
+	c, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	if c.Width*c.Height > maxImagePixels {
+		return ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	dst := resizeImage(src, width)
+	switch format {
+	case "png":
+		err = png.Encode(&buf, dst)
+	case "jpeg":
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	default:
+		err = ErrInvalidImageFormat
+	}
+	if err != nil {
+		return err
+	}
+
+	return Storage.Put(ctx, variant, &buf, int64(buf.Len()), imageFormats[format].ContentType)
+}
+
+// resizeImage scales the image down to the width, keeping its aspect ratio. Each pixel of the resized image is the
+// average of the pixels of the original image it covers.
+func resizeImage(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	if b.Dx() <= width {
+		return src
+	}
+
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	s := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(s, s.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*b.Dy()/height, (y+1)*b.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := x*b.Dx()/width, (x+1)*b.Dx()/width
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := s.PixOffset(sx, sy)
+					r += uint64(s.Pix[i])
+					g += uint64(s.Pix[i+1])
+					bl += uint64(s.Pix[i+2])
+					a += uint64(s.Pix[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
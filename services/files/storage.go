@@ -0,0 +1,69 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/george/shoya-go/config"
+	"io"
+	"log"
+	"time"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// Storage is the StorageBackend used by the files service.
+var Storage StorageBackend
+
+// ObjectInfo describes an object stored in a StorageBackend.
+type ObjectInfo struct {
+	Name         string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// StorageBackend is the interface that has to be implemented by everything files can be stored on.
+type StorageBackend interface {
+	// PresignGet returns a url that allows for the object to be downloaded until the expiry passes.
+	PresignGet(ctx context.Context, name string, expiry time.Duration) (string, error)
+	// PresignPut returns a url that allows for the object to be uploaded (in one part) until the expiry passes.
+	PresignPut(ctx context.Context, name, md5, contentType string, expiry time.Duration) (string, error)
+	// CreateMultipartUpload starts a multipart upload for the object & returns its id.
+	CreateMultipartUpload(ctx context.Context, name, contentType string) (string, error)
+	// PresignPart returns a url that allows for a part of a multipart upload to be uploaded until the expiry passes.
+	PresignPart(ctx context.Context, name, uploadId string, partNumber int, expiry time.Duration) (string, error)
+	// CompleteMultipartUpload assembles the object from its parts & returns its ETag.
+	CompleteMultipartUpload(ctx context.Context, name, uploadId string, etags []string) (string, error)
+	// AbortMultipartUpload discards a multipart upload & the parts uploaded so far.
+	AbortMultipartUpload(ctx context.Context, name, uploadId string) error
+	// Stat returns information about the object, or ErrObjectNotFound if it does not exist.
+	Stat(ctx context.Context, name string) (*ObjectInfo, error)
+	// Open returns a reader for the contents of the object, or ErrObjectNotFound if it does not exist.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Put stores the object, replacing it if it already exists.
+	Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error
+	// List calls fn for every object that is stored, stopping at the first error returned by it.
+	List(ctx context.Context, fn func(o *ObjectInfo) error) error
+	// Delete removes the object. Deleting an object that does not exist is not an error.
+	Delete(ctx context.Context, name string) error
+	// Ping checks that the bucket (or directory) objects are stored in exists, returning ErrBucketNotFound if it does not.
+	Ping(ctx context.Context) error
+}
+
+// initStorage initializes the StorageBackend selected in the configuration.
+func initStorage() {
+	switch config.RuntimeConfig.Files.Storage.Backend {
+	case "", "s3":
+		initMinioClient()
+		Storage = &minioStorage{}
+	case "local":
+		s, err := newLocalStorage(config.RuntimeConfig.Files.Storage)
+		if err != nil {
+			log.Fatalf("error initializing local storage: %v", err)
+		}
+		Storage = s
+	default:
+		log.Fatalf("unknown storage backend: %s", config.RuntimeConfig.Files.Storage.Backend)
+	}
+}
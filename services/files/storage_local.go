@@ -0,0 +1,495 @@
+package files
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/george/shoya-go/config"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidObjectName = errors.New("invalid object name")
+var ErrInvalidUpload = errors.New("invalid multipart upload")
+var ErrMd5Mismatch = errors.New("the md5 of the object does not match the signed md5")
+
+// localStorage is a StorageBackend that stores objects on the local disk. Uploads & downloads happen through signed,
+// expiring urls that are served by localStorage itself (see ServeHTTP).
+//
+// Directory layout:
+//
+//	objects/<name>            the objects themselves
+//	meta/<name>               the ETag of each object
+//	multipart/<uploadId>/     the parts of a multipart upload (& the name of the object they belong to)
+type localStorage struct {
+	root    string
+	baseUrl string
+	key     []byte
+}
+
+func newLocalStorage(c config.FilesStorageSvcConfig) (*localStorage, error) {
+	if c.LocalPath == "" || c.LocalBaseUrl == "" || c.LocalListenAddress == "" {
+		return nil, errors.New("localPath, localBaseUrl and localListenAddress are required")
+	}
+
+	if c.LocalSigningKey == "" {
+		return nil, errors.New("localSigningKey is required")
+	}
+
+	for _, dir := range []string{"objects", "meta", "multipart"} {
+		if err := os.MkdirAll(filepath.Join(c.LocalPath, dir), 0o750); err != nil {
+			return nil, err
+		}
+	}
+
+	return &localStorage{
+		root:    c.LocalPath,
+		baseUrl: strings.TrimSuffix(c.LocalBaseUrl, "/"),
+		key:     []byte(c.LocalSigningKey),
+	}, nil
+}
+
+// Serve serves the signed urls on the provided address.
+func (l *localStorage) Serve(addr string) {
+	log.Fatal(http.ListenAndServe(addr, l))
+}
+
+func (l *localStorage) PresignGet(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	return l.sign(http.MethodGet, name, url.Values{}, expiry)
+}
+
+func (l *localStorage) PresignPut(ctx context.Context, name, md5, contentType string, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("md5", md5)
+	return l.sign(http.MethodPut, name, params, expiry)
+}
+
+func (l *localStorage) CreateMultipartUpload(ctx context.Context, name, contentType string) (string, error) {
+	if _, err := l.objectPath(name); err != nil {
+		return "", err
+	}
+
+	uploadId := uuid.NewString()
+	dir := filepath.Join(l.root, "multipart", uploadId)
+	if err := os.Mkdir(dir, 0o750); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "name"), []byte(name), 0o640); err != nil {
+		return "", err
+	}
+
+	return uploadId, nil
+}
+
+func (l *localStorage) PresignPart(ctx context.Context, name, uploadId string, partNumber int, expiry time.Duration) (string, error) {
+	if _, err := l.uploadPath(name, uploadId); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("uploadId", uploadId)
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	return l.sign(http.MethodPut, name, params, expiry)
+}
+
+func (l *localStorage) CompleteMultipartUpload(ctx context.Context, name, uploadId string, etags []string) (string, error) {
+	var md5s []byte
+
+	dir, err := l.uploadPath(name, uploadId)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := l.objectPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(l.root, "objects"), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	for idx, etag := range etags {
+		sum, err := appendPart(tmp, filepath.Join(dir, strconv.Itoa(idx+1)))
+		if err != nil {
+			return "", err
+		}
+
+		if hex.EncodeToString(sum) != strings.Trim(etag, "\"") {
+			return "", fmt.Errorf("etag mismatch for part %d", idx+1)
+		}
+		md5s = append(md5s, sum...)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err = os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+
+	sum := md5.Sum(md5s)
+	etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(etags))
+	if err = l.writeETag(name, etag); err != nil {
+		return "", err
+	}
+
+	return etag, os.RemoveAll(dir)
+}
+
+func (l *localStorage) AbortMultipartUpload(ctx context.Context, name, uploadId string) error {
+	dir, err := l.uploadPath(name, uploadId)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (l *localStorage) Stat(ctx context.Context, name string) (*ObjectInfo, error) {
+	p, err := l.objectPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	etag, err := os.ReadFile(filepath.Join(l.root, "meta", url.PathEscape(name)))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &ObjectInfo{Name: name, Size: fi.Size(), ETag: string(etag), LastModified: fi.ModTime()}, nil
+}
+
+func (l *localStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := l.objectPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (l *localStorage) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	p, err := l.objectPath(name)
+	if err != nil {
+		return err
+	}
+
+	sum, err := writeFile(p, r, "")
+	if err != nil {
+		return err
+	}
+
+	return l.writeETag(name, hex.EncodeToString(sum))
+}
+
+func (l *localStorage) List(ctx context.Context, fn func(o *ObjectInfo) error) error {
+	entries, err := os.ReadDir(filepath.Join(l.root, "objects"))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		// Skip uploads that are still in progress.
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".upload-") {
+			continue
+		}
+
+		name, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+
+		o, err := l.Stat(ctx, name)
+		if err != nil {
+			if err == ErrObjectNotFound {
+				continue
+			}
+			return err
+		}
+
+		if err = fn(o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *localStorage) Delete(ctx context.Context, name string) error {
+	p, err := l.objectPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err = os.Remove(filepath.Join(l.root, "meta", url.PathEscape(name))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *localStorage) Ping(ctx context.Context) error {
+	fi, err := os.Stat(filepath.Join(l.root, "objects"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrBucketNotFound
+		}
+		return err
+	}
+
+	if !fi.IsDir() {
+		return ErrBucketNotFound
+	}
+
+	return nil
+}
+
+// ServeHTTP handles downloads (GET) & uploads (PUT) through the urls signed by localStorage.
+func (l *localStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/"))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	if !l.verify(r.Method, name, params) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		l.serveObject(w, r, name)
+	case http.MethodPut:
+		if params.Get("uploadId") != "" {
+			l.receivePart(w, r, name, params.Get("uploadId"), params.Get("partNumber"))
+			return
+		}
+		l.receiveObject(w, r, name, params.Get("md5"))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (l *localStorage) serveObject(w http.ResponseWriter, r *http.Request, name string) {
+	p, err := l.objectPath(name)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+}
+
+func (l *localStorage) receiveObject(w http.ResponseWriter, r *http.Request, name, expectedMd5 string) {
+	p, err := l.objectPath(name)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	sum, err := writeFile(p, r.Body, expectedMd5)
+	if err != nil {
+		if err == ErrMd5Mismatch {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("[%v] [LocalStorage] [ERROR]: %v", time.Now(), err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	etag := hex.EncodeToString(sum)
+	if err = l.writeETag(name, etag); err != nil {
+		log.Printf("[%v] [LocalStorage] [ERROR]: %v", time.Now(), err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", etag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (l *localStorage) receivePart(w http.ResponseWriter, r *http.Request, name, uploadId, partNumber string) {
+	dir, err := l.uploadPath(name, uploadId)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if n, err := strconv.Atoi(partNumber); err != nil || n < 1 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	sum, err := writeFile(filepath.Join(dir, partNumber), r.Body, "")
+	if err != nil {
+		log.Printf("[%v] [LocalStorage] [ERROR]: %v", time.Now(), err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", hex.EncodeToString(sum)))
+	w.WriteHeader(http.StatusOK)
+}
+
+// sign returns a url for the object that is valid for the method & params until the expiry passes.
+func (l *localStorage) sign(method, name string, params url.Values, expiry time.Duration) (string, error) {
+	if _, err := l.objectPath(name); err != nil {
+		return "", err
+	}
+
+	params.Set("expires", strconv.FormatInt(time.Now().Add(expiry).Unix(), 10))
+	params.Set("signature", l.signature(method, name, params))
+	return fmt.Sprintf("%s/%s?%s", l.baseUrl, url.PathEscape(name), params.Encode()), nil
+}
+
+// verify checks whether the signature in the params is valid for the method, name & the rest of the params, and
+// whether it has not expired yet.
+func (l *localStorage) verify(method, name string, params url.Values) bool {
+	signature := params.Get("signature")
+	params.Del("signature")
+
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(l.signature(method, name, params)))
+}
+
+func (l *localStorage) signature(method, name string, params url.Values) string {
+	h := hmac.New(sha256.New, l.key)
+	h.Write([]byte(fmt.Sprintf("%s\n%s\n%s", method, name, params.Encode())))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// objectPath returns the path an object is stored at.
+func (l *localStorage) objectPath(name string) (string, error) {
+	if name == "" {
+		return "", ErrInvalidObjectName
+	}
+
+	escaped := url.PathEscape(name)
+	if escaped == "." || escaped == ".." {
+		return "", ErrInvalidObjectName
+	}
+
+	return filepath.Join(l.root, "objects", escaped), nil
+}
+
+// uploadPath returns the directory the parts of a multipart upload for the object are stored in.
+func (l *localStorage) uploadPath(name, uploadId string) (string, error) {
+	if _, err := uuid.Parse(uploadId); err != nil {
+		return "", ErrInvalidUpload
+	}
+
+	dir := filepath.Join(l.root, "multipart", uploadId)
+	n, err := os.ReadFile(filepath.Join(dir, "name"))
+	if err != nil || string(n) != name {
+		return "", ErrInvalidUpload
+	}
+
+	return dir, nil
+}
+
+func (l *localStorage) writeETag(name, etag string) error {
+	return os.WriteFile(filepath.Join(l.root, "meta", url.PathEscape(name)), []byte(etag), 0o640)
+}
+
+// writeFile atomically writes the contents of r to the path & returns their MD5. If expectedMd5 (base64) is set, the
+// file is only written if the MD5 of the contents matches it.
+func writeFile(path string, r io.Reader, expectedMd5 string) ([]byte, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := md5.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		return nil, err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := h.Sum(nil)
+	if expectedMd5 != "" && base64.StdEncoding.EncodeToString(sum) != expectedMd5 {
+		return nil, ErrMd5Mismatch
+	}
+
+	return sum, os.Rename(tmp.Name(), path)
+}
+
+// appendPart appends the part at the path to w & returns its MD5.
+func appendPart(w io.Writer, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err = io.Copy(io.MultiWriter(w, h), f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
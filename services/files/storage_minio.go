@@ -0,0 +1,148 @@
+package files
+
+import (
+	"context"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"gitlab.com/george/shoya-go/config"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var MinioClient *minio.Core
+
+// minioStorage is a StorageBackend that stores objects in an S3-compatible bucket.
+type minioStorage struct{}
+
+func (m *minioStorage) PresignGet(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	u, err := MinioClient.PresignHeader(ctx, http.MethodGet, config.ApiConfiguration.FilesS3Bucket.Get(), name, expiry, make(url.Values), http.Header{})
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+func (m *minioStorage) PresignPut(ctx context.Context, name, md5, contentType string, expiry time.Duration) (string, error) {
+	headers := http.Header{}
+	headers.Add("Content-MD5", md5)
+	u, err := MinioClient.PresignHeader(ctx, http.MethodPut, config.ApiConfiguration.FilesS3Bucket.Get(), name, expiry, url.Values{}, headers)
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+func (m *minioStorage) CreateMultipartUpload(ctx context.Context, name, contentType string) (string, error) {
+	return MinioClient.NewMultipartUpload(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), name, minio.PutObjectOptions{ContentType: contentType})
+}
+
+func (m *minioStorage) PresignPart(ctx context.Context, name, uploadId string, partNumber int, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadId)
+
+	u, err := MinioClient.Presign(ctx, http.MethodPut, config.ApiConfiguration.FilesS3Bucket.Get(), name, expiry, params)
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+func (m *minioStorage) CompleteMultipartUpload(ctx context.Context, name, uploadId string, etags []string) (string, error) {
+	parts := make([]minio.CompletePart, len(etags))
+	for idx, etag := range etags {
+		parts[idx] = minio.CompletePart{PartNumber: idx + 1, ETag: etag}
+	}
+
+	return MinioClient.CompleteMultipartUpload(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), name, uploadId, parts, minio.PutObjectOptions{})
+}
+
+func (m *minioStorage) AbortMultipartUpload(ctx context.Context, name, uploadId string) error {
+	return MinioClient.AbortMultipartUpload(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), name, uploadId)
+}
+
+func (m *minioStorage) Stat(ctx context.Context, name string) (*ObjectInfo, error) {
+	o, err := MinioClient.StatObject(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), name, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return &ObjectInfo{Name: o.Key, Size: o.Size, ETag: o.ETag, LastModified: o.LastModified}, nil
+}
+
+func (m *minioStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, _, _, err := MinioClient.GetObject(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), name, minio.GetObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (m *minioStorage) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	_, err := MinioClient.Client.PutObject(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), name, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (m *minioStorage) List(ctx context.Context, fn func(o *ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for o := range MinioClient.Client.ListObjects(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), minio.ListObjectsOptions{Recursive: true}) {
+		if o.Err != nil {
+			return o.Err
+		}
+
+		if err := fn(&ObjectInfo{Name: o.Key, Size: o.Size, ETag: o.ETag, LastModified: o.LastModified}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *minioStorage) Delete(ctx context.Context, name string) error {
+	return MinioClient.RemoveObject(ctx, config.ApiConfiguration.FilesS3Bucket.Get(), name, minio.RemoveObjectOptions{})
+}
+
+func (m *minioStorage) Ping(ctx context.Context) error {
+	ok, err := MinioClient.BucketExists(ctx, config.ApiConfiguration.FilesS3Bucket.Get())
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrBucketNotFound
+	}
+
+	return nil
+}
+
+func initMinioClient() {
+	var endpointUrl = config.ApiConfiguration.FilesS3Endpoint.Get()
+	var endpointIsSecure = strings.Contains(endpointUrl, "https://")
+	var endpoint = strings.ReplaceAll(strings.ReplaceAll(endpointUrl, "https://", ""), "http://", "")
+	var err error
+	// Initialize minio client object.
+	MinioClient, err = minio.NewCore(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.ApiConfiguration.FilesS3AccessKey.Get(), config.ApiConfiguration.FilesS3SecretKey.Get(), ""),
+		Secure: endpointIsSecure,
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
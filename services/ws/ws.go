@@ -14,8 +14,8 @@ import (
 )
 
 func Main() {
-	if config.RuntimeConfig.Ws == nil {
-		log.Fatalf("error reading config: RuntimeConfig.Ws was nil")
+	if err := config.RuntimeConfig.Require("ws"); err != nil {
+		log.Fatalf("error reading config: %v", err)
 	}
 	app := fiber.New(fiber.Config{
 		ProxyHeader: config.RuntimeConfig.Ws.Fiber.ProxyHeader,